@@ -0,0 +1,303 @@
+package main
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/pbkdf2"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/hkdf"
+
+    "tableplus-connections/ui"
+)
+
+// Bitwarden item types.
+const (
+    bitwardenLogin      = 1
+    bitwardenSecureNote = 2
+)
+
+// Bitwarden key derivation functions.
+const (
+    bitwardenPBKDF2   = 0
+    bitwardenArgon2id = 1
+)
+
+// bitwardenExport is a Bitwarden JSON export, either plain or password
+// protected. A password protected export only holds Data.
+type bitwardenExport struct {
+    Encrypted         bool   `json:"encrypted"`
+    PasswordProtected bool   `json:"passwordProtected"`
+    Salt              string `json:"salt"`
+    KdfType           int    `json:"kdfType"`
+    KdfIterations     int    `json:"kdfIterations"`
+    KdfMemory         int    `json:"kdfMemory"` // MiB
+    KdfParallelism    int    `json:"kdfParallelism"`
+    KeyValidation     string `json:"encKeyValidation_DO_NOT_EDIT"`
+    Data              string `json:"data"`
+
+    Folders     []bitwardenFolder `json:"folders"`
+    Collections []bitwardenFolder `json:"collections"`
+    Items       []bitwardenItem   `json:"items"`
+}
+
+type bitwardenFolder struct {
+    ID   string `json:"id"`
+    Name string `json:"name"`
+}
+
+type bitwardenItem struct {
+    ID            string   `json:"id"`
+    FolderID      string   `json:"folderId"`
+    CollectionIDs []string `json:"collectionIds"`
+    Type          int      `json:"type"`
+    Name          string   `json:"name"`
+    Notes         string   `json:"notes"`
+    Fields        []struct {
+        Name  string `json:"name"`
+        Value string `json:"value"`
+    } `json:"fields"`
+    Login *struct {
+        Username string `json:"username"`
+        Password string `json:"password"`
+        URIs     []struct {
+            URI string `json:"uri"`
+        } `json:"uris"`
+    } `json:"login"`
+}
+
+// loadBitwarden reads the connections of a Bitwarden JSON export. Logins
+// and secure notes become connections when one of their URIs is a database
+// URL or their custom fields set a host, port, driver or database, as for
+// the other file sources; those without a host end up skipped. Folders,
+// or collections for organization exports, become groups.
+func loadBitwarden(opts ExportOptions) (*SourceResult, error) {
+    if opts.SourcePath == "" {
+        return nil, errors.New("The Bitwarden source needs the export file as --source-path")
+    }
+
+    data, err := os.ReadFile(opts.SourcePath)
+
+    if err != nil {
+        return nil, err
+    }
+
+    export := &bitwardenExport{}
+
+    if err := json.Unmarshal(data, export); err != nil {
+        return nil, fmt.Errorf("%s: %w", opts.SourcePath, err)
+    }
+
+    if export.Encrypted && !export.PasswordProtected {
+        return nil, errors.New("Account restricted Bitwarden exports can't be read, export with a password or unencrypted")
+    }
+
+    if export.PasswordProtected {
+        if opts.SourcePassword == "" {
+            return nil, errors.New("The Bitwarden export is password protected, pass the password with --source-password")
+        }
+
+        plain, err := decryptBitwardenExport(export, opts.SourcePassword)
+
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", opts.SourcePath, err)
+        }
+
+        export = &bitwardenExport{}
+
+        if err := json.Unmarshal(plain, export); err != nil {
+            return nil, fmt.Errorf("%s: %w", opts.SourcePath, err)
+        }
+    }
+
+    return parseBitwardenExport(export), nil
+}
+
+func parseBitwardenExport(export *bitwardenExport) *SourceResult {
+    result := &SourceResult{}
+    used := make(map[string]bool)
+
+    for _, item := range export.Items {
+        if item.Type != bitwardenLogin && item.Type != bitwardenSecureNote {
+            continue
+        }
+
+        connection := &AvailableConnection{
+            ID:   "bitwarden:" + item.ID,
+            Name: item.Name,
+        }
+
+        if item.Login != nil {
+            for _, uri := range item.Login.URIs {
+                if parseConnectionURL(uri.URI, connection) {
+                    break
+                }
+            }
+        }
+
+        for _, field := range item.Fields {
+            setConnectionField(connection, field.Name, field.Value)
+        }
+
+        if !describesDatabase(connection) {
+            continue
+        }
+
+        // The login's own credentials win over those in the URL
+        if item.Login != nil {
+            if item.Login.Username != "" {
+                connection.Username = item.Login.Username
+            }
+
+            if item.Login.Password != "" {
+                connection.Password = item.Login.Password
+            }
+        }
+
+        switch {
+        case len(item.CollectionIDs) > 0:
+            connection.GroupID = "collection:" + item.CollectionIDs[0]
+        case item.FolderID != "":
+            connection.GroupID = "folder:" + item.FolderID
+        }
+
+        if missing := completeConnection(connection); len(missing) > 0 {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:      connection.ID,
+                GroupID: connection.GroupID,
+                Name:    connection.Name,
+                Reason:  "missing or invalid " + strings.Join(missing, ", "),
+            })
+            continue
+        }
+
+        used[connection.GroupID] = true
+        result.Connections = append(result.Connections, connection)
+    }
+
+    for _, folder := range export.Folders {
+        if used["folder:"+folder.ID] {
+            result.Groups = append(result.Groups, &ui.Group{ID: "folder:" + folder.ID, Name: folder.Name})
+        }
+    }
+
+    for _, collection := range export.Collections {
+        if used["collection:"+collection.ID] {
+            result.Groups = append(result.Groups, &ui.Group{ID: "collection:" + collection.ID, Name: collection.Name})
+        }
+    }
+
+    return result
+}
+
+// decryptBitwardenExport decrypts the data of a password protected export,
+// with a key derived from the password like Bitwarden does for its PIN: the
+// KDF output stretched with HKDF into an AES-CBC and an HMAC key.
+func decryptBitwardenExport(export *bitwardenExport, password string) ([]byte, error) {
+    var key []byte
+
+    switch export.KdfType {
+    case bitwardenPBKDF2:
+        var err error
+        key, err = pbkdf2.Key(sha256.New, password, []byte(export.Salt), export.KdfIterations, 32)
+
+        if err != nil {
+            return nil, err
+        }
+
+    case bitwardenArgon2id:
+        salt := sha256.Sum256([]byte(export.Salt))
+        key = argon2.IDKey([]byte(password), salt[:], uint32(export.KdfIterations), uint32(export.KdfMemory)*1024, uint8(export.KdfParallelism), 32)
+
+    default:
+        return nil, fmt.Errorf("unsupported key derivation function %d", export.KdfType)
+    }
+
+    encKey := make([]byte, 32)
+    macKey := make([]byte, 32)
+
+    if _, err := io.ReadFull(hkdf.Expand(sha256.New, key, []byte("enc")), encKey); err != nil {
+        return nil, err
+    }
+
+    if _, err := io.ReadFull(hkdf.Expand(sha256.New, key, []byte("mac")), macKey); err != nil {
+        return nil, err
+    }
+
+    if export.KeyValidation != "" {
+        if _, err := decryptBitwardenString(export.KeyValidation, encKey, macKey); err != nil {
+            return nil, errors.New("wrong password")
+        }
+    }
+
+    return decryptBitwardenString(export.Data, encKey, macKey)
+}
+
+// decryptBitwardenString decrypts an encrypted string of type 2:
+// "2.iv|ciphertext|mac", AES-256-CBC with an HMAC-SHA256 over iv and
+// ciphertext, all base64.
+func decryptBitwardenString(s string, encKey, macKey []byte) ([]byte, error) {
+    encType, rest, ok := strings.Cut(s, ".")
+
+    if !ok || encType != "2" {
+        return nil, errors.New("unsupported encryption type")
+    }
+
+    parts := strings.Split(rest, "|")
+
+    if len(parts) != 3 {
+        return nil, errors.New("malformed encrypted string")
+    }
+
+    var decoded [3][]byte
+
+    for i, part := range parts {
+        var err error
+        decoded[i], err = base64.StdEncoding.DecodeString(part)
+
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    iv, ciphertext, mac := decoded[0], decoded[1], decoded[2]
+
+    h := hmac.New(sha256.New, macKey)
+    h.Write(iv)
+    h.Write(ciphertext)
+
+    if !hmac.Equal(h.Sum(nil), mac) {
+        return nil, errors.New("MAC mismatch")
+    }
+
+    block, err := aes.NewCipher(encKey)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+        return nil, errors.New("malformed ciphertext")
+    }
+
+    plain := make([]byte, len(ciphertext))
+    cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+    padding := int(plain[len(plain)-1])
+
+    if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+        return nil, errors.New("bad padding")
+    }
+
+    return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "slices"
+    "time"
+
+    "github.com/zalando/go-keyring"
+)
+
+// cacheKeyEnv overrides the key the metadata cache is encrypted with, which
+// is generated and stored in the OS keychain otherwise.
+const cacheKeyEnv = "TABLEPLUS_CONNECTIONS_CACHE_KEY"
+
+// keychainService and cacheKeyAccount name the cache key in the keychain.
+const (
+    keychainService = "tableplus-connections"
+    cacheKeyAccount = "metadata-cache-key"
+)
+
+// defaultCacheMaxAge is how long the metadata cache is used before it is
+// built again.
+const defaultCacheMaxAge = 24 * time.Hour
+
+// MetadataCache holds the non-secret metadata of the connections of an
+// account, so that the picker shows the details of items it isn't reading.
+type MetadataCache struct {
+    CreatedAt   time.Time            `json:"createdAt"`
+    Categories  []string             `json:"categories"` // read besides Database
+    Connections []ConnectionMetadata `json:"connections"`
+}
+
+// ConnectionMetadata is the non-secret part of a connection.
+type ConnectionMetadata struct {
+    ID          string    `json:"id"`
+    Account     string    `json:"account"`
+    GroupID     string    `json:"groupId"`
+    Name        string    `json:"name"`
+    Category    string    `json:"category"`
+    Host        string    `json:"host"`
+    Port        int       `json:"port"`
+    Driver      string    `json:"driver"`
+    Database    string    `json:"database"`
+    Environment string    `json:"environment"`
+    Tags        []string  `json:"tags"`
+    UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// cachePath returns the location of the metadata cache of the export's
+// accounts, in the user cache dir.
+func cachePath(opts ExportOptions) (string, error) {
+    dir, err := os.UserCacheDir()
+
+    if err != nil {
+        return "", err
+    }
+
+    sum := sha256.Sum256([]byte(stateKey(opts)))
+
+    return filepath.Join(dir, "tableplus-connections", "metadata-"+hex.EncodeToString(sum[:8])+".cache"), nil
+}
+
+// cacheKey returns the key the metadata cache is encrypted with, creating
+// it on first use. It's kept in the OS keychain, not next to the cache.
+func cacheKey() ([]byte, error) {
+    if key := os.Getenv(cacheKeyEnv); key != "" {
+        sum := sha256.Sum256([]byte(key))
+        return sum[:], nil
+    }
+
+    encoded, err := keyring.Get(keychainService, cacheKeyAccount)
+
+    if err == nil {
+        key, err := hex.DecodeString(encoded)
+
+        if err == nil && len(key) == 32 {
+            return key, nil
+        }
+    }
+
+    if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+        return nil, fmt.Errorf("Could not read the cache key from the keychain, set %s instead: %w", cacheKeyEnv, err)
+    }
+
+    key := make([]byte, 32)
+
+    if _, err := rand.Read(key); err != nil {
+        return nil, err
+    }
+
+    if err := keyring.Set(keychainService, cacheKeyAccount, hex.EncodeToString(key)); err != nil {
+        return nil, fmt.Errorf("Could not store the cache key in the keychain, set %s instead: %w", cacheKeyEnv, err)
+    }
+
+    return key, nil
+}
+
+func cacheCipher() (cipher.AEAD, error) {
+    key, err := cacheKey()
+
+    if err != nil {
+        return nil, err
+    }
+
+    block, err := aes.NewCipher(key)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return cipher.NewGCM(block)
+}
+
+// loadMetadataCache reads the metadata cache. A missing cache is nil.
+func loadMetadataCache(opts ExportOptions) (*MetadataCache, error) {
+    path, err := cachePath(opts)
+
+    if err != nil {
+        return nil, err
+    }
+
+    data, err := os.ReadFile(path)
+
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    aead, err := cacheCipher()
+
+    if err != nil {
+        return nil, err
+    }
+
+    if len(data) < aead.NonceSize() {
+        return nil, fmt.Errorf("%s: truncated", path)
+    }
+
+    plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+
+    cache := &MetadataCache{}
+
+    return cache, json.Unmarshal(plain, cache)
+}
+
+// saveMetadataCache encrypts and writes the metadata cache.
+func saveMetadataCache(opts ExportOptions, cache *MetadataCache) error {
+    path, err := cachePath(opts)
+
+    if err != nil {
+        return err
+    }
+
+    plain, err := json.Marshal(cache)
+
+    if err != nil {
+        return err
+    }
+
+    aead, err := cacheCipher()
+
+    if err != nil {
+        return err
+    }
+
+    nonce := make([]byte, aead.NonceSize())
+
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return err
+    }
+
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+
+    return os.WriteFile(path, aead.Seal(nonce, nonce, plain, nil), 0600)
+}
+
+// newMetadataCache creates a cache of the connections.
+func newMetadataCache(connections []*AvailableConnection) *MetadataCache {
+    cache := &MetadataCache{CreatedAt: time.Now()}
+    cache.update(connections)
+
+    return cache
+}
+
+// update replaces the metadata of the connections, keeping the others.
+func (c *MetadataCache) update(connections []*AvailableConnection) {
+    for _, connection := range connections {
+        metadata := ConnectionMetadata{
+            ID:          connection.ID,
+            Account:     connection.Account,
+            GroupID:     connection.GroupID,
+            Name:        connection.Name,
+            Category:    connection.Category,
+            Host:        connection.Address,
+            Port:        connection.Port,
+            Driver:      connection.Driver,
+            Database:    connection.Database,
+            Environment: connection.Environment,
+            Tags:        connection.Tags,
+            UpdatedAt:   connection.UpdatedAt,
+        }
+
+        i := slices.IndexFunc(c.Connections, func(m ConnectionMetadata) bool { return m.ID == connection.ID })
+
+        if i < 0 {
+            c.Connections = append(c.Connections, metadata)
+        } else {
+            c.Connections[i] = metadata
+        }
+    }
+}
+
+// lookup returns the cached metadata of an item.
+func (c *MetadataCache) lookup(id string) (ConnectionMetadata, bool) {
+    i := slices.IndexFunc(c.Connections, func(m ConnectionMetadata) bool { return m.ID == id })
+
+    if i < 0 {
+        return ConnectionMetadata{}, false
+    }
+
+    return c.Connections[i], true
+}
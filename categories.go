@@ -0,0 +1,154 @@
+package main
+
+import (
+    "fmt"
+    "slices"
+    "strings"
+
+    "github.com/1password/onepassword-sdk-go"
+)
+
+// itemCategories are the 1Password categories that can be read besides
+// Database, by the names --category accepts.
+var itemCategories = map[string]onepassword.ItemCategory{
+    "login":          onepassword.ItemCategoryLogin,
+    "server":         onepassword.ItemCategoryServer,
+    "api_credential": onepassword.ItemCategoryAPICredentials,
+    "secure_note":    onepassword.ItemCategorySecureNote,
+}
+
+var categoryNames = []string{"login", "server", "api_credential", "secure_note"}
+
+// normalizeCategory returns the name of a category as --category accepts
+// it, like "Secure Note" or "api-credential".
+func normalizeCategory(name string) string {
+    name = strings.ToLower(strings.TrimSpace(name))
+
+    return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+// normalizeCategories returns the sorted normalized names of categories,
+// as the metadata cache records them.
+func normalizeCategories(names []string) []string {
+    var normalized []string
+
+    for _, name := range names {
+        normalized = append(normalized, normalizeCategory(name))
+    }
+
+    slices.Sort(normalized)
+
+    return slices.Compact(normalized)
+}
+
+// parseCategories returns the categories read besides Database.
+func parseCategories(names []string) ([]onepassword.ItemCategory, error) {
+    var categories []onepassword.ItemCategory
+
+    for _, name := range names {
+        category, ok := itemCategories[normalizeCategory(name)]
+
+        if !ok {
+            return nil, fmt.Errorf("Unknown category %q, expected one of %s", name, strings.Join(categoryNames, ", "))
+        }
+
+        categories = append(categories, category)
+    }
+
+    return categories, nil
+}
+
+// categoryName returns the name rules match the category of an item by.
+func categoryName(category onepassword.ItemCategory) string {
+    for name, c := range itemCategories {
+        if c == category {
+            return name
+        }
+    }
+
+    return normalizeCategory(string(category))
+}
+
+// isCandidateItem reports whether an item of an opted-in category may
+// describe a database. Logins only do when one of their websites is a
+// database URL, which their overview tells.
+func isCandidateItem(overview onepassword.ItemOverview) bool {
+    if overview.Category != onepassword.ItemCategoryLogin {
+        return true
+    }
+
+    for _, website := range overview.Websites {
+        if parseConnectionString(website.URL, &AvailableConnection{}) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// connectionFromItem maps an item of an opted-in category to a connection:
+// a Login with a database URL as website, a Server with a database URL or
+// host as URL, an API Credential with a hostname, or a Secure Note with
+// "key: value" lines. Custom fields are read like those of Database items.
+// It reports false for items that don't describe a database, which takes a
+// database URL or connection string, or a driver or database field.
+func connectionFromItem(item *onepassword.Item) (*AvailableConnection, bool) {
+    connection := &AvailableConnection{
+        ID:        item.ID,
+        GroupID:   item.VaultID,
+        Name:      item.Title,
+        Category:  categoryName(item.Category),
+        Tags:      item.Tags,
+        UpdatedAt: item.UpdatedAt,
+    }
+
+    for _, website := range item.Websites {
+        if parseConnectionString(website.URL, connection) {
+            break
+        }
+    }
+
+    if item.Category == onepassword.ItemCategorySecureNote {
+        for _, line := range strings.Split(item.Notes, "\n") {
+            if key, value, ok := strings.Cut(line, ":"); ok {
+                setConnectionField(connection, key, value)
+            }
+        }
+    }
+
+    var username, password string
+
+    for _, field := range item.Fields {
+        switch field.ID {
+        case "username":
+            username = field.Value
+        case "password", "credential":
+            password = field.Value
+        case "hostname":
+            connection.Address = field.Value
+        case "url":
+            if !parseConnectionString(field.Value, connection) {
+                connection.Address, connection.Port = splitHostPort(field.Value, connection.Port)
+            }
+        default:
+            setConnectionField(connection, field.Title, field.Value)
+        }
+    }
+
+    // A host alone, like the admin URL of a Server or the hostname of an
+    // API Credential, doesn't make the item a database's
+    if connection.Driver == "" && connection.Database == "" {
+        return nil, false
+    }
+
+    // The item's own credentials win over those in a URL
+    if username != "" {
+        connection.Username = username
+    }
+
+    if password != "" {
+        connection.Password = password
+    }
+
+    return connection, true
+}
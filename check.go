@@ -0,0 +1,463 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "net"
+    "net/url"
+    "os"
+    "os/exec"
+    "os/user"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
+    "text/tabwriter"
+    "time"
+
+    "github.com/go-sql-driver/mysql"
+    "github.com/jackc/pgx/v5/pgconn"
+    "golang.org/x/crypto/ssh"
+    "golang.org/x/crypto/ssh/agent"
+    "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// CheckStatus is the outcome of checking a connection.
+type CheckStatus string
+
+const (
+    CheckOK          CheckStatus = "ok"          // logged in
+    CheckReachable   CheckStatus = "reachable"   // port open, driver can't be logged in to
+    CheckAuthFailed  CheckStatus = "auth-failed" // credentials rejected
+    CheckTimeout     CheckStatus = "timeout"
+    CheckUnreachable CheckStatus = "unreachable"
+    CheckSSHFailed   CheckStatus = "ssh-failed" // tunnel not opened, database not reached
+    CheckError       CheckStatus = "error"
+)
+
+// sshTunnelError is a failure to open the SSH tunnel of a connection. It
+// says nothing of the database's credentials, the cause is often a local
+// key or agent.
+type sshTunnelError struct {
+    err error
+}
+
+func (e *sshTunnelError) Error() string {
+    return "SSH: " + e.err.Error()
+}
+
+func (e *sshTunnelError) Unwrap() error {
+    return e.err
+}
+
+// CheckOptions configure how connections are checked.
+type CheckOptions struct {
+    Concurrency int
+    Timeout     time.Duration
+    InsecureSSH bool // don't verify SSH host keys
+}
+
+// CheckResult is the outcome of checking a single connection.
+type CheckResult struct {
+    Connection *AvailableConnection
+    Status     CheckStatus
+    Detail     string
+    Duration   time.Duration
+}
+
+// mysqlSSHNetwork is the network name the MySQL driver dials SSH tunnels
+// through. The tunnel is taken from the context.
+const mysqlSSHNetwork = "tableplus-connections-ssh"
+
+type sshClientKey struct{}
+
+func init() {
+    mysql.RegisterDialContext(mysqlSSHNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+        client, ok := ctx.Value(sshClientKey{}).(*ssh.Client)
+
+        if !ok {
+            return nil, errors.New("no SSH tunnel")
+        }
+
+        return client.DialContext(ctx, "tcp", addr)
+    })
+}
+
+// addCheckFlags registers the flags configuring connection checks.
+func addCheckFlags(fs *flag.FlagSet, opts *CheckOptions) {
+    fs.IntVar(&opts.Concurrency, "concurrency", 8, "Number of connections checked at the same time")
+    fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "Time to wait for each connection check")
+    fs.BoolVar(&opts.InsecureSSH, "insecure-ssh", false, "Don't verify SSH host keys against ~/.ssh/known_hosts")
+}
+
+func checkCommand(args []string) error {
+    var opts ExportOptions
+
+    fs := newFlagSet("check", "[accounts...]", "Connect to the picked connections and log in with their credentials, without exporting")
+    addSourceFlags(fs, &opts)
+    addCheckFlags(fs, &opts.Check)
+    fs.BoolVar(&opts.All, "all", false, "Check all connections, without interactive input")
+    fs.BoolVar(&opts.All, "a", false, "Check all connections, without interactive input (shorthand)")
+    fs.BoolVar(&opts.NoState, "no-state", false, "Don't pre-select the previous selection, and don't remember this one")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if err := resolveOptions(fs, &opts); err != nil {
+        return err
+    }
+
+    selected, _, err := selectConnections(opts)
+
+    if err != nil {
+        return err
+    }
+
+    results := checkConnections(selected, opts.Check)
+
+    if err := writeCheckResults(os.Stdout, results); err != nil {
+        return err
+    }
+
+    for _, result := range results {
+        if result.Status != CheckOK && result.Status != CheckReachable {
+            return errors.New("Some connections failed")
+        }
+    }
+
+    return nil
+}
+
+// checkConnections checks the connections, opts.Concurrency at a time, and
+// returns the results in the order of the connections.
+func checkConnections(connections []*AvailableConnection, opts CheckOptions) []CheckResult {
+    results := make([]CheckResult, len(connections))
+    limit := make(chan struct{}, max(opts.Concurrency, 1))
+    var wg sync.WaitGroup
+
+    for i, c := range connections {
+        wg.Add(1)
+        limit <- struct{}{}
+
+        go func() {
+            defer wg.Done()
+            defer func() { <-limit }()
+
+            results[i] = checkConnection(c, opts)
+        }()
+    }
+
+    wg.Wait()
+
+    return results
+}
+
+// checkConnection connects to the database, through its SSH tunnel if it
+// has one, and logs in for the drivers that support it.
+func checkConnection(c *AvailableConnection, opts CheckOptions) CheckResult {
+    start := time.Now()
+    ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+    defer cancel()
+
+    status, err := dialAndLogin(ctx, c, opts)
+    result := CheckResult{Connection: c, Status: status, Duration: time.Since(start)}
+
+    if err != nil {
+        result.Status, result.Detail = classifyCheckError(status, err)
+    }
+
+    return result
+}
+
+func dialAndLogin(ctx context.Context, c *AvailableConnection, opts CheckOptions) (CheckStatus, error) {
+    var tunnel *ssh.Client
+
+    if c.SSH != nil {
+        var err error
+        tunnel, err = dialSSH(ctx, c.SSH, opts)
+
+        if err != nil {
+            return CheckSSHFailed, &sshTunnelError{err}
+        }
+
+        defer tunnel.Close()
+        ctx = context.WithValue(ctx, sshClientKey{}, tunnel)
+    }
+
+    dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+        if tunnel != nil {
+            return tunnel.DialContext(ctx, network, addr)
+        }
+
+        var dialer net.Dialer
+        return dialer.DialContext(ctx, network, addr)
+    }
+
+    password := c.Password
+
+    if c.PasswordIsCommand {
+        out, err := exec.CommandContext(ctx, "sh", "-c", c.Password).Output()
+
+        if err != nil {
+            return CheckError, fmt.Errorf("password command: %w", err)
+        }
+
+        password = strings.TrimRight(string(out), "\r\n")
+    }
+
+    switch connectionDriver(c) {
+    case DriverPostgreSQL, DriverRedshift, DriverCockroachDB:
+        return checkPostgres(ctx, c, password, dial)
+    case DriverMySQL, DriverMariaDB:
+        return checkMySQL(ctx, c, password, tunnel != nil)
+    }
+
+    conn, err := dial(ctx, "tcp", net.JoinHostPort(c.Address, strconv.Itoa(c.Port)))
+
+    if err != nil {
+        return CheckUnreachable, err
+    }
+
+    conn.Close()
+
+    return CheckReachable, nil
+}
+
+func checkPostgres(ctx context.Context, c *AvailableConnection, password string, dial pgconn.DialFunc) (CheckStatus, error) {
+    database := c.Database
+
+    // Like libpq, default to the database named after the user
+    if database == "" {
+        database = c.Username
+    }
+
+    // Disable is also the mode of connections that don't set one. Prefer
+    // falls back to plain connections, so it logs in wherever disable would.
+    sslmode := map[int]string{
+        TLSModeDisable:    "prefer",
+        TLSModePrefer:     "prefer",
+        TLSModeRequire:    "require",
+        TLSModeVerifyCA:   "verify-ca",
+        TLSModeVerifyFull: "verify-full",
+    }[c.TLSMode]
+
+    dsn := url.URL{
+        Scheme:   "postgres",
+        User:     url.UserPassword(c.Username, password),
+        Host:     net.JoinHostPort(c.Address, strconv.Itoa(c.Port)),
+        Path:     "/" + database,
+        RawQuery: url.Values{"sslmode": {sslmode}}.Encode(),
+    }
+
+    config, err := pgconn.ParseConfig(dsn.String())
+
+    if err != nil {
+        return CheckError, err
+    }
+
+    config.DialFunc = dial
+
+    conn, err := pgconn.ConnectConfig(ctx, config)
+
+    if err != nil {
+        return CheckUnreachable, err
+    }
+
+    return CheckOK, conn.Close(ctx)
+}
+
+func checkMySQL(ctx context.Context, c *AvailableConnection, password string, overSSH bool) (CheckStatus, error) {
+    config := mysql.NewConfig()
+    config.User = c.Username
+    config.Passwd = password
+    config.Net = "tcp"
+    config.Addr = net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+    config.DBName = c.Database
+    config.AllowNativePasswords = true
+    // Preferred for unset modes too, as for PostgreSQL
+    config.TLSConfig = map[int]string{
+        TLSModeDisable:    "preferred",
+        TLSModePrefer:     "preferred",
+        TLSModeRequire:    "skip-verify",
+        TLSModeVerifyCA:   "true",
+        TLSModeVerifyFull: "true",
+    }[c.TLSMode]
+
+    if overSSH {
+        config.Net = mysqlSSHNetwork
+    }
+
+    connector, err := mysql.NewConnector(config)
+
+    if err != nil {
+        return CheckError, err
+    }
+
+    db := sql.OpenDB(connector)
+    defer db.Close()
+
+    if err := db.PingContext(ctx); err != nil {
+        return CheckUnreachable, err
+    }
+
+    return CheckOK, nil
+}
+
+// dialSSH connects to the SSH server of a tunnel, authenticating with its
+// password, the SSH agent or the default unencrypted keys in ~/.ssh.
+func dialSSH(ctx context.Context, tunnel *SSHTunnel, opts CheckOptions) (*ssh.Client, error) {
+    username := tunnel.User
+
+    if username == "" {
+        if current, err := user.Current(); err == nil {
+            username = current.Username
+        }
+    }
+
+    var auth []ssh.AuthMethod
+
+    if tunnel.Password != "" {
+        auth = append(auth, ssh.Password(tunnel.Password))
+    }
+
+    if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+        if conn, err := net.Dial("unix", socket); err == nil {
+            defer conn.Close()
+            auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+        }
+    }
+
+    home, _ := os.UserHomeDir()
+    var signers []ssh.Signer
+
+    for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+        key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+
+        if err != nil {
+            continue
+        }
+
+        if signer, err := ssh.ParsePrivateKey(key); err == nil {
+            signers = append(signers, signer)
+        }
+    }
+
+    if len(signers) > 0 {
+        auth = append(auth, ssh.PublicKeys(signers...))
+    }
+
+    hostKeyCallback := ssh.InsecureIgnoreHostKey()
+
+    if !opts.InsecureSSH {
+        var err error
+        hostKeyCallback, err = knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+
+        if err != nil {
+            return nil, fmt.Errorf("reading known hosts: %w", err)
+        }
+    }
+
+    port := tunnel.Port
+
+    if port == 0 {
+        port = 22
+    }
+
+    addr := net.JoinHostPort(tunnel.Host, strconv.Itoa(port))
+
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(ctx, "tcp", addr)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+
+    sshConn, channels, requests, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+        User:            username,
+        Auth:            auth,
+        HostKeyCallback: hostKeyCallback,
+    })
+
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    // The deadline was for the handshake only
+    conn.SetDeadline(time.Time{})
+
+    return ssh.NewClient(sshConn, channels, requests), nil
+}
+
+// classifyCheckError refines the status of a failed check from its error.
+func classifyCheckError(status CheckStatus, err error) (CheckStatus, string) {
+    var pgErr *pgconn.PgError
+    var mysqlErr *mysql.MySQLError
+    var netErr net.Error
+    var tunnelErr *sshTunnelError
+
+    switch {
+    case errors.As(err, &tunnelErr):
+        return CheckSSHFailed, err.Error()
+
+    case errors.As(err, &pgErr):
+        // 28P01 invalid_password
+        if pgErr.Code == "28P01" {
+            return CheckAuthFailed, pgErr.Message
+        }
+
+        // 28000 invalid_authorization_specification comes from pg_hba.conf,
+        // like a host rule that needs TLS, not from the credentials
+        if pgErr.Code == "28000" {
+            return CheckError, "rejected by pg_hba.conf or the TLS settings: " + pgErr.Message
+        }
+
+        return CheckError, pgErr.Message
+
+    case errors.As(err, &mysqlErr):
+        // ER_ACCESS_DENIED_ERROR, ER_DBACCESS_DENIED_ERROR
+        if mysqlErr.Number == 1045 || mysqlErr.Number == 1044 {
+            return CheckAuthFailed, mysqlErr.Message
+        }
+
+        return CheckError, mysqlErr.Message
+
+    case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+        return CheckTimeout, err.Error()
+
+    case errors.Is(err, syscall.ECONNREFUSED):
+        return CheckUnreachable, err.Error()
+    }
+
+    return status, err.Error()
+}
+
+// writeCheckResults prints the results as an aligned table.
+func writeCheckResults(w io.Writer, results []CheckResult) error {
+    tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+    fmt.Fprintln(tw, "NAME\tHOST\tSTATUS\tTIME\tDETAIL")
+
+    for _, r := range results {
+        c := r.Connection
+        host := net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+
+        if c.SSH != nil {
+            host += " via " + c.SSH.Host
+        }
+
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Name, host, r.Status, r.Duration.Round(time.Millisecond), r.Detail)
+    }
+
+    return tw.Flush()
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/aes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "tableplus-connections/ui"
+)
+
+// The sources reading the configuration of the command line clients each
+// read a file given as --source-path, or the one the client reads.
+
+// loadPgpass reads a .pgpass file: one connection per
+// host:port:database:user:password line.
+func loadPgpass(opts ExportOptions) (*SourceResult, error) {
+    file := opts.SourcePath
+
+    if file == "" {
+        file = defaultPgpassFile()
+    }
+
+    result := &SourceResult{}
+
+    if err := readPgpass(file, result); err != nil {
+        return nil, err
+    }
+
+    return result, nil
+}
+
+// loadPgService reads a pg_service.conf file: one connection per service.
+// Passwords missing from it are looked up in .pgpass, like libpq does.
+func loadPgService(opts ExportOptions) (*SourceResult, error) {
+    file := opts.SourcePath
+
+    if file == "" {
+        file = defaultPgServiceFile()
+    }
+
+    result := &SourceResult{}
+
+    if err := readPgService(file, result); err != nil {
+        return nil, err
+    }
+
+    return result, nil
+}
+
+// loadMySQLOptions reads a MySQL option file, ~/.my.cnf by default, or an
+// obfuscated login path file like ~/.mylogin.cnf: one connection per client
+// section.
+func loadMySQLOptions(opts ExportOptions) (*SourceResult, error) {
+    result := &SourceResult{}
+
+    if opts.SourcePath != "" {
+        if err := readMySQLOptions(opts.SourcePath, result); err != nil {
+            return nil, err
+        }
+
+        return result, nil
+    }
+
+    for _, file := range defaultMySQLOptionFiles() {
+        if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+            continue
+        }
+
+        if err := readMySQLOptions(file, result); err != nil {
+            return nil, err
+        }
+    }
+
+    if len(result.Groups) == 0 {
+        return nil, errors.New("No MySQL option file found, set --source-path")
+    }
+
+    return result, nil
+}
+
+// loadCLIConfig reads every client configuration file found in its default
+// location, to convert a command line setup in one go.
+func loadCLIConfig(opts ExportOptions) (*SourceResult, error) {
+    type cliFile struct {
+        file string
+        read func(string, *SourceResult) error
+    }
+
+    result := &SourceResult{}
+    readers := []cliFile{{defaultPgpassFile(), readPgpass}, {defaultPgServiceFile(), readPgService}}
+
+    for _, file := range defaultMySQLOptionFiles() {
+        readers = append(readers, cliFile{file, readMySQLOptions})
+    }
+
+    for _, reader := range readers {
+        if _, err := os.Stat(reader.file); errors.Is(err, os.ErrNotExist) {
+            continue
+        }
+
+        if err := reader.read(reader.file, result); err != nil {
+            return nil, err
+        }
+    }
+
+    return result, nil
+}
+
+func defaultPgpassFile() string {
+    if file := os.Getenv("PGPASSFILE"); file != "" {
+        return file
+    }
+
+    return expandHome("~/.pgpass")
+}
+
+func defaultPgServiceFile() string {
+    if file := os.Getenv("PGSERVICEFILE"); file != "" {
+        return file
+    }
+
+    return expandHome("~/.pg_service.conf")
+}
+
+func defaultMySQLOptionFiles() []string {
+    files := []string{expandHome("~/.my.cnf")}
+
+    if file := os.Getenv("MYSQL_TEST_LOGIN_FILE"); file != "" {
+        return append(files, file)
+    }
+
+    return append(files, expandHome("~/.mylogin.cnf"))
+}
+
+// fileGroup adds the group of the connections read from a file.
+func fileGroup(result *SourceResult, file string) string {
+    id := "file:" + file
+    name := file
+
+    if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(file, home+string(filepath.Separator)) {
+        name = "~" + strings.TrimPrefix(file, home)
+    }
+
+    result.Groups = append(result.Groups, &ui.Group{ID: id, Name: name})
+
+    return id
+}
+
+// addFileConnection adds a connection read from a file, or skips it when
+// it's missing fields.
+func addFileConnection(result *SourceResult, connection *AvailableConnection) {
+    if missing := completeConnection(connection); len(missing) > 0 {
+        result.Skipped = append(result.Skipped, SkippedItem{
+            ID:      connection.ID,
+            GroupID: connection.GroupID,
+            Name:    connection.Name,
+            Reason:  "missing or invalid " + strings.Join(missing, ", "),
+        })
+        return
+    }
+
+    result.Connections = append(result.Connections, connection)
+}
+
+// pgpassEntry is a line of a .pgpass file. Any field but the password can
+// be a * wildcard.
+type pgpassEntry struct {
+    Host, Port, Database, User, Password string
+}
+
+// parsePgpass parses a .pgpass file, with its \: and \\ escapes.
+func parsePgpass(data []byte) []pgpassEntry {
+    var entries []pgpassEntry
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), "\r")
+
+        if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+            continue
+        }
+
+        var fields []string
+        var field strings.Builder
+
+        for i := 0; i < len(line); i++ {
+            switch {
+            case line[i] == '\\' && i+1 < len(line):
+                i++
+                field.WriteByte(line[i])
+            case line[i] == ':' && len(fields) < 4:
+                fields = append(fields, field.String())
+                field.Reset()
+            default:
+                field.WriteByte(line[i])
+            }
+        }
+
+        if fields = append(fields, field.String()); len(fields) == 5 {
+            entries = append(entries, pgpassEntry{fields[0], fields[1], fields[2], fields[3], fields[4]})
+        }
+    }
+
+    return entries
+}
+
+// matches reports whether the entry applies to a connection.
+func (e pgpassEntry) matches(host, port, database, user string) bool {
+    match := func(pattern, value string) bool { return pattern == "*" || pattern == value }
+
+    return match(e.Host, host) && match(e.Port, port) && match(e.Database, database) && match(e.User, user)
+}
+
+func readPgpass(file string, result *SourceResult) error {
+    data, err := os.ReadFile(file)
+
+    if err != nil {
+        return err
+    }
+
+    group := fileGroup(result, file)
+
+    for _, entry := range parsePgpass(data) {
+        key := strings.Join([]string{entry.Host, entry.Port, entry.Database, entry.User}, ":")
+        connection := &AvailableConnection{
+            ID:       "pgpass:" + file + "#" + key,
+            GroupID:  group,
+            Name:     entry.User + "@" + entry.Host,
+            Driver:   DriverPostgreSQL,
+            Username: entry.User,
+            Password: entry.Password,
+        }
+
+        if entry.Database != "*" {
+            connection.Database = entry.Database
+            connection.Name += "/" + entry.Database
+        }
+
+        if entry.Host == "*" {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:      connection.ID,
+                GroupID: group,
+                Name:    connection.Name,
+                Reason:  "wildcard host",
+            })
+            continue
+        }
+
+        connection.Address = entry.Host
+        connection.Port, _ = strconv.Atoi(entry.Port)
+        addFileConnection(result, connection)
+    }
+
+    return nil
+}
+
+// iniSection is a section of an INI style file, as pg_service.conf and
+// MySQL option files are.
+type iniSection struct {
+    Name   string
+    Values map[string]string
+}
+
+// parseINI parses an INI style file. Values can be quoted; MySQL's
+// !include and !includedir directives are followed.
+func parseINI(file string, data []byte, sections []*iniSection) ([]*iniSection, error) {
+    var current *iniSection
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+
+        switch {
+        case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+        case strings.HasPrefix(line, "!include"):
+            directive, target, _ := strings.Cut(line, " ")
+            target = strings.TrimSpace(target)
+
+            if !filepath.IsAbs(target) {
+                target = filepath.Join(filepath.Dir(file), target)
+            }
+
+            included := []string{target}
+
+            if directive == "!includedir" {
+                included, _ = filepath.Glob(filepath.Join(target, "*.cnf"))
+            }
+
+            for _, include := range included {
+                data, err := os.ReadFile(include)
+
+                if err != nil {
+                    return nil, err
+                }
+
+                if sections, err = parseINI(include, data, sections); err != nil {
+                    return nil, err
+                }
+            }
+
+            // Included sections don't continue the current one
+            current = nil
+        case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+            name := strings.TrimSpace(line[1 : len(line)-1])
+            current = nil
+
+            for _, section := range sections {
+                if section.Name == name {
+                    current = section
+                }
+            }
+
+            if current == nil {
+                current = &iniSection{Name: name, Values: make(map[string]string)}
+                sections = append(sections, current)
+            }
+        case current != nil:
+            key, value, _ := strings.Cut(line, "=")
+            key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+            value = strings.TrimSpace(value)
+
+            if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+                value = value[1 : len(value)-1]
+            }
+
+            current.Values[key] = value
+        }
+    }
+
+    return sections, nil
+}
+
+func readPgService(file string, result *SourceResult) error {
+    data, err := os.ReadFile(file)
+
+    if err != nil {
+        return err
+    }
+
+    sections, err := parseINI(file, data, nil)
+
+    if err != nil {
+        return err
+    }
+
+    pgpass, _ := os.ReadFile(defaultPgpassFile())
+    entries := parsePgpass(pgpass)
+    group := fileGroup(result, file)
+
+    for _, section := range sections {
+        values := section.Values
+        connection := &AvailableConnection{
+            ID:       "pgservice:" + file + "#" + section.Name,
+            GroupID:  group,
+            Name:     section.Name,
+            Driver:   DriverPostgreSQL,
+            Address:  firstValue(values, "host", "hostaddr"),
+            Username: values["user"],
+            Password: values["password"],
+            Database: values["dbname"],
+        }
+
+        connection.Port, _ = strconv.Atoi(values["port"])
+
+        if mode, ok := parseTLSMode(values["sslmode"]); ok {
+            connection.TLSMode = mode
+        }
+
+        if connection.Password == "" {
+            port := values["port"]
+
+            if port == "" {
+                port = strconv.Itoa(defaultPorts[DriverPostgreSQL])
+            }
+
+            database := connection.Database
+
+            if database == "" {
+                database = connection.Username
+            }
+
+            for _, entry := range entries {
+                if entry.matches(connection.Address, port, database, connection.Username) {
+                    connection.Password = entry.Password
+                    break
+                }
+            }
+        }
+
+        addFileConnection(result, connection)
+    }
+
+    return nil
+}
+
+func readMySQLOptions(file string, result *SourceResult) error {
+    data, err := os.ReadFile(file)
+
+    if err != nil {
+        return err
+    }
+
+    // Login path files hold client sections only, whatever their name
+    loginPaths := strings.HasSuffix(file, "login.cnf")
+
+    if loginPaths {
+        if data, err = decryptMySQLLoginFile(data); err != nil {
+            return fmt.Errorf("%s: %w", file, err)
+        }
+    }
+
+    sections, err := parseINI(file, data, nil)
+
+    if err != nil {
+        return err
+    }
+
+    group := fileGroup(result, file)
+
+    for _, section := range sections {
+        // Server sections, and client tools without connections
+        if !strings.HasPrefix(section.Name, "client") && section.Name != "mysql" && !loginPaths {
+            continue
+        }
+
+        values := section.Values
+        connection := &AvailableConnection{
+            ID:       "mysql:" + file + "#" + section.Name,
+            GroupID:  group,
+            Name:     section.Name,
+            Driver:   DriverMySQL,
+            Address:  values["host"],
+            Username: values["user"],
+            Password: firstValue(values, "password", "pass"),
+            Database: values["database"],
+        }
+
+        connection.Port, _ = strconv.Atoi(values["port"])
+
+        if mode, ok := parseTLSMode(values["ssl-mode"]); ok {
+            connection.TLSMode = mode
+        }
+
+        // Socket connections default to localhost
+        if connection.Address == "" && values["socket"] == "" && connection.Username != "" {
+            connection.Address = "localhost"
+        }
+
+        addFileConnection(result, connection)
+    }
+
+    return nil
+}
+
+// decryptMySQLLoginFile decrypts a login path file written by
+// mysql_config_editor: 4 unused bytes, a 20 byte key folded into an AES-128
+// key, then length prefixed AES-128-ECB encrypted lines.
+func decryptMySQLLoginFile(data []byte) ([]byte, error) {
+    if len(data) < 24 {
+        return nil, errors.New("truncated login path file")
+    }
+
+    var key [16]byte
+
+    for i, b := range data[4:24] {
+        key[i%16] ^= b
+    }
+
+    block, err := aes.NewCipher(key[:])
+
+    if err != nil {
+        return nil, err
+    }
+
+    var plain bytes.Buffer
+
+    for data = data[24:]; len(data) >= 4; {
+        length := int(binary.LittleEndian.Uint32(data))
+        data = data[4:]
+
+        if length == 0 || length%aes.BlockSize != 0 || length > len(data) {
+            return nil, errors.New("corrupted login path file")
+        }
+
+        line := make([]byte, length)
+
+        for i := 0; i < length; i += aes.BlockSize {
+            block.Decrypt(line[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+        }
+
+        if padding := int(line[length-1]); padding > 0 && padding <= aes.BlockSize {
+            line = line[:length-padding]
+        }
+
+        plain.Write(line)
+        data = data[length:]
+    }
+
+    return plain.Bytes(), nil
+}
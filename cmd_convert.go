@@ -0,0 +1,91 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+)
+
+func convertCommand(args []string) error {
+    var password, newPassword, format, output string
+
+    fs := newFlagSet("convert", "<file>", "Convert an export between the encrypted and JSON formats, or change its password")
+    fs.StringVar(&password, "password", "password", "Password of the export")
+    fs.StringVar(&password, "p", "password", "Password of the export (shorthand)")
+    fs.StringVar(&newPassword, "new-password", "", "Password to encrypt the result with (default: the current password)")
+    fs.StringVar(&format, "format", "tableplus", "Format to convert to: tableplus or json")
+    fs.StringVar(&output, "output", "", "Output filename, without extension (default: the input filename, with -converted for the same format)")
+    fs.StringVar(&output, "o", "", "Output filename, without extension (shorthand)")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if fs.NArg() != 1 {
+        fs.Usage()
+        return errors.New("Expected exactly one export file")
+    }
+
+    if !slices.Contains(formatNames, format) {
+        return fmt.Errorf("Unknown format %q", format)
+    }
+
+    input := fs.Arg(0)
+
+    if newPassword == "" {
+        newPassword = password
+    }
+
+    explicit := output != ""
+
+    if !explicit {
+        output = strings.TrimSuffix(input, filepath.Ext(input))
+    }
+
+    // Converting to the same format would write over the input
+    if sameFile(input, exportFileName(output, format)) {
+        if explicit {
+            return fmt.Errorf("%s is the input file, pick another --output", exportFileName(output, format))
+        }
+
+        output += "-converted"
+    }
+
+    data, err := readExportFile(input, password)
+
+    if err != nil {
+        return err
+    }
+
+    // Make sure it's an export before writing it out again
+    if _, err := parseExport(data); err != nil {
+        return fmt.Errorf("%s: %w", input, err)
+    }
+
+    outputFile, err := writeExport(json.RawMessage(data), output, format, newPassword)
+
+    if err != nil {
+        return err
+    }
+
+    fmt.Println("Converted to", outputFile)
+
+    return nil
+}
+
+// sameFile reports whether both paths name the same existing file.
+func sameFile(a, b string) bool {
+    infoA, err := os.Stat(a)
+
+    if err != nil {
+        return false
+    }
+
+    infoB, err := os.Stat(b)
+
+    return err == nil && os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "maps"
+    "slices"
+)
+
+// errDifferences is returned by diff when the exports differ, so the exit
+// status can be used in scripts.
+var errDifferences = errors.New("Exports differ")
+
+func diffCommand(args []string) error {
+    var password, otherPassword string
+
+    fs := newFlagSet("diff", "<old> <new>", "Compare the connections of two exports, matched by group and name. Exits with status 1 when they differ.")
+    fs.StringVar(&password, "password", "password", "Password of both exports")
+    fs.StringVar(&password, "p", "password", "Password of both exports (shorthand)")
+    fs.StringVar(&otherPassword, "new-password", "", "Password of the new export, if it differs")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if fs.NArg() != 2 {
+        fs.Usage()
+        return errors.New("Expected two export files")
+    }
+
+    if otherPassword == "" {
+        otherPassword = password
+    }
+
+    before, err := loadExport(fs.Arg(0), password)
+
+    if err != nil {
+        return err
+    }
+
+    after, err := loadExport(fs.Arg(1), otherPassword)
+
+    if err != nil {
+        return err
+    }
+
+    changes, err := diffExports(before, after)
+
+    if err != nil {
+        return err
+    }
+
+    if len(changes) == 0 {
+        fmt.Println("No differences")
+        return nil
+    }
+
+    for _, change := range changes {
+        fmt.Println(change)
+    }
+
+    return errDifferences
+}
+
+// entryKey identifies a connection across exports.
+func entryKey(e ExportEntry) string {
+    if e.Group == "" {
+        return e.Connection.ConnectionName
+    }
+
+    return e.Group + " / " + e.Connection.ConnectionName
+}
+
+// diffExports describes the differences between two exports, one line per
+// added, removed or changed connection. Secrets are reported as changed
+// without their values.
+func diffExports(before, after []ExportEntry) ([]string, error) {
+    old := make(map[string]ExportEntry, len(before))
+    for _, e := range before {
+        old[entryKey(e)] = e
+    }
+
+    updated := make(map[string]ExportEntry, len(after))
+    for _, e := range after {
+        updated[entryKey(e)] = e
+    }
+
+    var changes []string
+
+    for _, key := range slices.Sorted(maps.Keys(old)) {
+        if _, ok := updated[key]; !ok {
+            changes = append(changes, "- "+key)
+        }
+    }
+
+    for _, key := range slices.Sorted(maps.Keys(updated)) {
+        previous, ok := old[key]
+
+        if !ok {
+            changes = append(changes, "+ "+key)
+            continue
+        }
+
+        fields, err := diffConnections(previous.Connection, updated[key].Connection)
+
+        if err != nil {
+            return nil, err
+        }
+
+        for _, field := range fields {
+            changes = append(changes, "~ "+key+": "+field)
+        }
+    }
+
+    return changes, nil
+}
+
+// diffConnections describes the fields that differ between two connections.
+func diffConnections(a, b *OutputConnection) ([]string, error) {
+    fieldsA, err := connectionFields(a)
+
+    if err != nil {
+        return nil, err
+    }
+
+    fieldsB, err := connectionFields(b)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var changes []string
+
+    for _, name := range slices.Sorted(maps.Keys(fieldsA)) {
+        if string(fieldsA[name]) == string(fieldsB[name]) {
+            continue
+        }
+
+        if slices.Contains(secretFields, name) {
+            changes = append(changes, name+" changed")
+            continue
+        }
+
+        changes = append(changes, fmt.Sprintf("%s %s -> %s", name, fieldsA[name], fieldsB[name]))
+    }
+
+    return changes, nil
+}
+
+// connectionFields returns the JSON encoding of every field of a connection.
+func connectionFields(c *OutputConnection) (map[string]json.RawMessage, error) {
+    data, err := json.Marshal(c)
+
+    if err != nil {
+        return nil, err
+    }
+
+    fields := make(map[string]json.RawMessage)
+
+    return fields, json.Unmarshal(data, &fields)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "runtime"
+)
+
+// doctorCheck is a single check of the doctor command. It returns a short
+// description of what it found, and an error when something is wrong.
+type doctorCheck struct {
+    Name  string
+    Check func() (string, error)
+}
+
+func doctorCommand(args []string) error {
+    fs := newFlagSet("doctor", "", "Check the environment for common problems")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    failed := false
+
+    for _, check := range doctorChecks() {
+        result, err := check.Check()
+
+        if err != nil {
+            fmt.Printf("✗ %s: %s\n", check.Name, err)
+            failed = true
+            continue
+        }
+
+        fmt.Printf("✓ %s: %s\n", check.Name, result)
+    }
+
+    if failed {
+        return errors.New("Some checks failed")
+    }
+
+    return nil
+}
+
+func doctorChecks() []doctorCheck {
+    return []doctorCheck{
+        {Name: "Platform", Check: checkPlatform},
+        {Name: "TablePlus", Check: checkAppInstalled("TablePlus")},
+        {Name: "1Password", Check: checkAppInstalled("1Password")},
+        {Name: "1Password authentication", Check: checkAuth},
+        {Name: "Config file", Check: checkConfigFile},
+        {Name: "State file", Check: checkStateFile},
+    }
+}
+
+func checkPlatform() (string, error) {
+    if runtime.GOOS != "darwin" {
+        return fmt.Sprintf("%s, --open is only supported on macOS", runtime.GOOS), nil
+    }
+
+    return runtime.GOOS, nil
+}
+
+// checkAppInstalled looks for a macOS application bundle.
+func checkAppInstalled(app string) func() (string, error) {
+    return func() (string, error) {
+        if runtime.GOOS != "darwin" {
+            return "not checked outside of macOS", nil
+        }
+
+        dirs := []string{"/Applications"}
+
+        if home, err := os.UserHomeDir(); err == nil {
+            dirs = append(dirs, filepath.Join(home, "Applications"))
+        }
+
+        for _, dir := range dirs {
+            bundle := filepath.Join(dir, app+".app")
+
+            if _, err := os.Stat(bundle); err == nil {
+                return bundle, nil
+            }
+        }
+
+        return "", fmt.Errorf("%s.app not found in %v", app, dirs)
+    }
+}
+
+func checkAuth() (string, error) {
+    auth, err := resolveAuth(AuthAuto)
+
+    if err != nil {
+        return "", err
+    }
+
+    if auth == AuthServiceAccount {
+        return "service account, " + serviceAccountTokenEnv + " is set", nil
+    }
+
+    return "desktop app, set " + serviceAccountTokenEnv + " for headless use", nil
+}
+
+func checkConfigFile() (string, error) {
+    path, err := defaultConfigPath()
+
+    if err != nil {
+        return "", err
+    }
+
+    if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+        return path + " does not exist, profiles are unavailable", nil
+    }
+
+    config, err := loadConfig(path)
+
+    if err != nil {
+        return "", err
+    }
+
+    return fmt.Sprintf("%s, %d profiles", path, len(config.Profiles)), nil
+}
+
+func checkStateFile() (string, error) {
+    path, err := statePath()
+
+    if err != nil {
+        return "", err
+    }
+
+    state, err := loadState()
+
+    if err != nil {
+        return "", fmt.Errorf("%s: %w", path, err)
+    }
+
+    return fmt.Sprintf("%s, selections of %d accounts", path, len(state.Accounts)), nil
+}
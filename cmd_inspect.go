@@ -0,0 +1,93 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+)
+
+func inspectCommand(args []string) error {
+    var password string
+    var mask bool
+
+    fs := newFlagSet("inspect", "<file>", "Decrypt an export and print its JSON")
+    fs.StringVar(&password, "password", "password", "Export password")
+    fs.StringVar(&password, "p", "password", "Export password (shorthand)")
+    fs.BoolVar(&mask, "mask", false, "Replace passwords with asterisks")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if fs.NArg() != 1 {
+        fs.Usage()
+        return errors.New("Expected exactly one export file")
+    }
+
+    data, err := readExportFile(fs.Arg(0), password)
+
+    if err != nil {
+        return err
+    }
+
+    if mask {
+        data, err = maskExportPasswords(data)
+
+        if err != nil {
+            return err
+        }
+    }
+
+    var out bytes.Buffer
+
+    if err := json.Indent(&out, data, "", "  "); err != nil {
+        return err
+    }
+
+    out.WriteByte('\n')
+    _, err = out.WriteTo(os.Stdout)
+
+    return err
+}
+
+// secretFields are the OutputConnection JSON keys holding secrets.
+var secretFields = []string{"DatabasePassword", "ServerPassword", "DatabaseKeyPassword"}
+
+// maskExportPasswords replaces every non-empty secret in an export's JSON.
+func maskExportPasswords(data []byte) ([]byte, error) {
+    var raw []map[string]any
+
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return nil, err
+    }
+
+    maskObject := func(object map[string]any) {
+        for _, field := range secretFields {
+            if value, ok := object[field].(string); ok && value != "" {
+                object[field] = "********"
+            }
+        }
+    }
+
+    for _, object := range raw {
+        maskObject(object)
+
+        if connections, ok := object["connections"].([]any); ok {
+            for _, connection := range connections {
+                if c, ok := connection.(map[string]any); ok {
+                    maskObject(c)
+                }
+            }
+        }
+    }
+
+    masked, err := json.Marshal(raw)
+
+    if err != nil {
+        return nil, fmt.Errorf("masking passwords: %w", err)
+    }
+
+    return masked, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "slices"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+)
+
+// ListedConnection is a row of the list command.
+type ListedConnection struct {
+    ID          string `json:"id"`
+    Name        string `json:"name"`
+    Vault       string `json:"vault"`
+    Driver      string `json:"driver,omitempty"`
+    Host        string `json:"host,omitempty"`
+    Port        int    `json:"port,omitempty"`
+    User        string `json:"user,omitempty"`
+    Environment string `json:"environment,omitempty"`
+    Skipped     string `json:"skipped,omitempty"` // why the item can't be exported
+}
+
+var listColumns = []string{"NAME", "VAULT", "DRIVER", "HOST", "PORT", "USER", "ENVIRONMENT", "SKIPPED"}
+
+func listCommand(args []string) error {
+    var opts ExportOptions
+    var format string
+    var noSkipped bool
+
+    fs := newFlagSet("list", "[accounts...]", "List the connections a source holds, without exporting")
+    addSourceFlags(fs, &opts)
+    fs.StringVar(&format, "format", "table", "Output format: table, csv or json")
+    fs.BoolVar(&noSkipped, "no-skipped", false, "Leave out items that can't be exported")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if err := resolveOptions(fs, &opts); err != nil {
+        return err
+    }
+
+    var write func(io.Writer, []ListedConnection) error
+
+    switch format {
+    case "table":
+        write = writeListTable
+    case "csv":
+        write = writeListCSV
+    case "json":
+        write = writeListJSON
+    default:
+        return fmt.Errorf("Unknown format %q", format)
+    }
+
+    source, err := loadConnections(opts)
+
+    if err != nil {
+        return err
+    }
+
+    rows := listRows(source, !noSkipped)
+
+    return write(os.Stdout, rows)
+}
+
+// listRows turns a source result into rows sorted by vault and name.
+func listRows(source *SourceResult, withSkipped bool) []ListedConnection {
+    groupNames := groupNameMap(source.Groups)
+    var rows []ListedConnection
+
+    for _, c := range source.Connections {
+        rows = append(rows, ListedConnection{
+            ID:          c.ID,
+            Name:        c.Name,
+            Vault:       groupNames[c.GroupID],
+            Driver:      connectionDriver(c),
+            Host:        c.Address,
+            Port:        c.Port,
+            User:        c.Username,
+            Environment: connectionEnvironment(c),
+        })
+    }
+
+    if withSkipped {
+        for _, item := range source.Skipped {
+            rows = append(rows, ListedConnection{
+                ID:      item.ID,
+                Name:    item.Name,
+                Vault:   groupNames[item.GroupID],
+                Skipped: item.Reason,
+            })
+        }
+    }
+
+    slices.SortStableFunc(rows, func(a, b ListedConnection) int {
+        if c := strings.Compare(a.Vault, b.Vault); c != 0 {
+            return c
+        }
+
+        return strings.Compare(a.Name, b.Name)
+    })
+
+    return rows
+}
+
+// fields returns the row's values in the order of listColumns.
+func (r ListedConnection) fields() []string {
+    port := ""
+
+    if r.Port != 0 {
+        port = strconv.Itoa(r.Port)
+    }
+
+    return []string{r.Name, r.Vault, r.Driver, r.Host, port, r.User, r.Environment, r.Skipped}
+}
+
+func writeListTable(w io.Writer, rows []ListedConnection) error {
+    tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+    fmt.Fprintln(tw, strings.Join(listColumns, "\t"))
+
+    for _, row := range rows {
+        fmt.Fprintln(tw, strings.Join(row.fields(), "\t"))
+    }
+
+    return tw.Flush()
+}
+
+func writeListCSV(w io.Writer, rows []ListedConnection) error {
+    cw := csv.NewWriter(w)
+
+    header := make([]string, len(listColumns))
+
+    for i, column := range listColumns {
+        header[i] = strings.ToLower(column)
+    }
+
+    if err := cw.Write(header); err != nil {
+        return err
+    }
+
+    for _, row := range rows {
+        if err := cw.Write(row.fields()); err != nil {
+            return err
+        }
+    }
+
+    cw.Flush()
+
+    return cw.Error()
+}
+
+func writeListJSON(w io.Writer, rows []ListedConnection) error {
+    if rows == nil {
+        rows = []ListedConnection{}
+    }
+
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+
+    return encoder.Encode(rows)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strconv"
+)
+
+func validateCommand(args []string) error {
+    var configPath, password string
+
+    fs := newFlagSet("validate", "[export files...]", "Check the config file and export files for errors")
+    fs.StringVar(&configPath, "config", "", "Config file path (default ~/.config/tableplus-connections/config.yaml)")
+    fs.StringVar(&password, "password", "password", "Password of the export files")
+    fs.StringVar(&password, "p", "password", "Password of the export files (shorthand)")
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    failed := false
+
+    // The default config file is optional, one given explicitly is not
+    explicitConfig := configPath != ""
+
+    if !explicitConfig {
+        var err error
+        configPath, err = defaultConfigPath()
+
+        if err != nil {
+            return err
+        }
+    }
+
+    if _, err := os.Stat(configPath); err == nil || explicitConfig {
+        if config, err := loadConfig(configPath); err != nil {
+            fmt.Printf("%s: %s\n", configPath, err)
+            failed = true
+        } else {
+            fmt.Printf("%s: ok, %d profiles\n", configPath, len(config.Profiles))
+        }
+    }
+
+    for _, file := range fs.Args() {
+        entries, err := loadExport(file, password)
+
+        if err != nil {
+            fmt.Println(err)
+            failed = true
+            continue
+        }
+
+        problems := validateExport(entries)
+
+        for _, problem := range problems {
+            fmt.Printf("%s: %s\n", file, problem)
+        }
+
+        if len(problems) > 0 {
+            failed = true
+        } else {
+            fmt.Printf("%s: ok, %d connections\n", file, len(entries))
+        }
+    }
+
+    if failed {
+        return errors.New("Validation failed")
+    }
+
+    return nil
+}
+
+// validateExport returns the problems TablePlus would have importing the
+// connections.
+func validateExport(entries []ExportEntry) []string {
+    var problems []string
+
+    for _, e := range entries {
+        c := e.Connection
+        name := entryKey(e)
+
+        if c.ConnectionName == "" {
+            problems = append(problems, "connection without a name")
+            name = "(unnamed)"
+        }
+
+        if normalizeDriver(c.Driver) == "" {
+            problems = append(problems, fmt.Sprintf("%s: unknown driver %q", name, c.Driver))
+        }
+
+        if c.Driver != DriverSQLite && c.DatabaseHost == "" && c.IsUseSocket == 0 {
+            problems = append(problems, fmt.Sprintf("%s: no host", name))
+        }
+
+        if _, err := strconv.Atoi(c.DatabasePort); c.Driver != DriverSQLite && err != nil {
+            problems = append(problems, fmt.Sprintf("%s: invalid port %q", name, c.DatabasePort))
+        }
+
+        if c.IsOverSSH == 1 && c.ServerAddress == "" {
+            problems = append(problems, fmt.Sprintf("%s: SSH enabled without an SSH host", name))
+        }
+
+        if normalizeEnvironment(c.Enviroment) == "" {
+            problems = append(problems, fmt.Sprintf("%s: unknown environment %q", name, c.Enviroment))
+        }
+    }
+
+    return problems
+}
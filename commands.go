@@ -0,0 +1,116 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "slices"
+    "strings"
+)
+
+const programName = "tableplus-connections"
+
+// command is a subcommand of the CLI.
+type command struct {
+    Name    string
+    Aliases []string
+    Summary string
+    Run     func(args []string) error
+}
+
+// commands returns every subcommand, in the order they are listed in help.
+func commands() []*command {
+    return []*command{
+        {Name: "export", Summary: "Pick connections and write a TablePlus export (default)", Run: exportCommand},
+        {Name: "list", Summary: "List the connections a source holds, without exporting", Run: listCommand},
+        {Name: "check", Summary: "Log in to the picked connections to find stale credentials", Run: checkCommand},
+        {Name: "inspect", Aliases: []string{"decrypt"}, Summary: "Decrypt an export and print its JSON", Run: inspectCommand},
+        {Name: "diff", Summary: "Compare the connections of two exports", Run: diffCommand},
+        {Name: "validate", Summary: "Check the config file and export files for errors", Run: validateCommand},
+        {Name: "doctor", Summary: "Check the environment for common problems", Run: doctorCommand},
+        {Name: "convert", Summary: "Convert an export between formats or passwords", Run: convertCommand},
+    }
+}
+
+// findCommand looks up a command by name or alias.
+func findCommand(name string) *command {
+    for _, cmd := range commands() {
+        if cmd.Name == name || slices.Contains(cmd.Aliases, name) {
+            return cmd
+        }
+    }
+
+    return nil
+}
+
+// runCommand runs the command named by the first argument. Without a known
+// command name, the arguments are passed to export, so the invocation from
+// before subcommands existed keeps working.
+func runCommand(args []string) error {
+    if len(args) > 0 {
+        switch args[0] {
+        case "help", "-h", "-help", "--help":
+            return helpCommand(args[1:])
+        }
+
+        if cmd := findCommand(args[0]); cmd != nil {
+            return ignoreHelp(cmd.Run(args[1:]))
+        }
+    }
+
+    return ignoreHelp(exportCommand(args))
+}
+
+// ignoreHelp turns the error returned after printing -h output into success.
+func ignoreHelp(err error) error {
+    if errors.Is(err, flag.ErrHelp) {
+        return nil
+    }
+
+    return err
+}
+
+func helpCommand(args []string) error {
+    if len(args) > 0 {
+        cmd := findCommand(args[0])
+
+        if cmd == nil {
+            return fmt.Errorf("Unknown command %q", args[0])
+        }
+
+        return ignoreHelp(cmd.Run([]string{"-h"}))
+    }
+
+    out := flag.CommandLine.Output()
+
+    fmt.Fprintf(out, "Usage: %s [command] [flags] [arguments]\n\nCommands:\n", programName)
+
+    for _, cmd := range commands() {
+        name := cmd.Name
+
+        if len(cmd.Aliases) > 0 {
+            name += " (" + strings.Join(cmd.Aliases, ", ") + ")"
+        }
+
+        fmt.Fprintf(out, "  %-20s %s\n", name, cmd.Summary)
+    }
+
+    fmt.Fprintf(out, "\nWithout a command, export is run. Use \"%s help <command>\" for its flags.\n", programName)
+
+    return nil
+}
+
+// newFlagSet creates the flag set of a command, with help output listing
+// its arguments and summary.
+func newFlagSet(name, arguments, summary string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    fs.SetOutput(os.Stderr)
+
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", programName, name, arguments, summary)
+        fs.PrintDefaults()
+    }
+
+    return fs
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io/fs"
+    "maps"
+    "os"
+    "path/filepath"
+    "regexp"
+    "slices"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "tableplus-connections/ui"
+)
+
+// composeFileNames are the names docker compose looks for, in its order.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"}
+
+// composeImages maps the repositories of database images, without Docker
+// Hub's registry and library namespace, to their driver. Other images of a
+// database's name, like mongo-express or postgres-exporter, don't count.
+var composeImages = map[string]string{
+    "postgres":                         DriverPostgreSQL,
+    "postgis/postgis":                  DriverPostgreSQL,
+    "timescale/timescaledb":            DriverPostgreSQL,
+    "timescale/timescaledb-ha":         DriverPostgreSQL,
+    "pgvector/pgvector":                DriverPostgreSQL,
+    "bitnami/postgresql":               DriverPostgreSQL,
+    "mysql":                            DriverMySQL,
+    "mysql/mysql-server":               DriverMySQL,
+    "bitnami/mysql":                    DriverMySQL,
+    "mariadb":                          DriverMariaDB,
+    "bitnami/mariadb":                  DriverMariaDB,
+    "redis":                            DriverRedis,
+    "redis/redis-stack":                DriverRedis,
+    "redis/redis-stack-server":         DriverRedis,
+    "bitnami/redis":                    DriverRedis,
+    "valkey/valkey":                    DriverRedis,
+    "bitnami/valkey":                   DriverRedis,
+    "mongo":                            DriverMongoDB,
+    "mongodb/mongodb-community-server": DriverMongoDB,
+    "bitnami/mongodb":                  DriverMongoDB,
+    "mcr.microsoft.com/mssql/server":   DriverSQLServer,
+    "mcr.microsoft.com/azure-sql-edge": DriverSQLServer,
+}
+
+// composeSkipDirs are the directories not searched for compose files.
+var composeSkipDirs = []string{".git", "node_modules", "vendor", ".venv"}
+
+type composeFile struct {
+    Name     string                    `yaml:"name"`
+    Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+    Image       string    `yaml:"image"`
+    Ports       []any     `yaml:"ports"`
+    Environment yaml.Node `yaml:"environment"`
+    EnvFile     yaml.Node `yaml:"env_file"`
+}
+
+// loadCompose reads the database services of docker compose files: the
+// one given as --source-path, or those found below that directory, or the
+// current one. Services count when their image is a database's; they're
+// reached on their published port, with the credentials their environment
+// sets up. Every compose project is a group.
+func loadCompose(opts ExportOptions) (*SourceResult, error) {
+    root := opts.SourcePath
+
+    if root == "" {
+        root = "."
+    }
+
+    info, err := os.Stat(root)
+
+    if err != nil {
+        return nil, err
+    }
+
+    files := []string{root}
+
+    if info.IsDir() {
+        if files, err = findComposeFiles(root); err != nil {
+            return nil, err
+        }
+
+        if len(files) == 0 {
+            return nil, fmt.Errorf("No compose file found in %s", root)
+        }
+    }
+
+    result := &SourceResult{}
+
+    for _, file := range files {
+        if err := readComposeFile(file, result); err != nil {
+            return nil, fmt.Errorf("%s: %w", file, err)
+        }
+    }
+
+    return result, nil
+}
+
+// findComposeFiles returns the compose file of every directory below root,
+// the first one of composeFileNames when there are several.
+func findComposeFiles(root string) ([]string, error) {
+    var files []string
+
+    err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+
+        if !d.IsDir() {
+            return nil
+        }
+
+        if path != root && slices.Contains(composeSkipDirs, d.Name()) {
+            return filepath.SkipDir
+        }
+
+        for _, name := range composeFileNames {
+            if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+                files = append(files, filepath.Join(path, name))
+                break
+            }
+        }
+
+        return nil
+    })
+
+    return files, err
+}
+
+func readComposeFile(file string, result *SourceResult) error {
+    data, err := os.ReadFile(file)
+
+    if err != nil {
+        return err
+    }
+
+    dir := filepath.Dir(file)
+
+    // Variables come from the environment, then from the project's .env
+    variables := make(map[string]string)
+
+    if dotEnv, err := os.ReadFile(filepath.Join(dir, ".env")); err == nil {
+        variables = parseEnvFile(dotEnv, nil)
+    }
+
+    for _, v := range os.Environ() {
+        if key, value, ok := strings.Cut(v, "="); ok {
+            variables[key] = value
+        }
+    }
+
+    var document yaml.Node
+
+    if err := yaml.Unmarshal(data, &document); err != nil {
+        return err
+    }
+
+    if err := interpolateComposeNode(&document, variables); err != nil {
+        return err
+    }
+
+    compose := &composeFile{}
+
+    if err := document.Decode(compose); err != nil {
+        return err
+    }
+
+    project := compose.Name
+
+    if project == "" {
+        project = variables["COMPOSE_PROJECT_NAME"]
+    }
+
+    if project == "" {
+        abs, err := filepath.Abs(dir)
+
+        if err != nil {
+            return err
+        }
+
+        project = composeProjectName(filepath.Base(abs))
+    }
+
+    group := &ui.Group{ID: "compose:" + project, Name: project, Description: file}
+    used := false
+
+    for _, name := range slices.Sorted(maps.Keys(compose.Services)) {
+        service := compose.Services[name]
+        driver := composeDriver(service.Image)
+
+        if driver == "" {
+            continue
+        }
+
+        env, err := service.environment(dir)
+
+        if err != nil {
+            return fmt.Errorf("service %s: %w", name, err)
+        }
+
+        connection := &AvailableConnection{
+            ID:          "compose:" + project + "/" + name,
+            GroupID:     group.ID,
+            Name:        name,
+            Driver:      driver,
+            Environment: EnvironmentLocal,
+        }
+
+        setComposeCredentials(connection, env)
+        used = true
+
+        host, port, ok := publishedPort(service.Ports, defaultPorts[driver])
+
+        if !ok {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:      connection.ID,
+                GroupID: connection.GroupID,
+                Name:    connection.Name,
+                Reason:  fmt.Sprintf("port %d not published", defaultPorts[driver]),
+            })
+            continue
+        }
+
+        connection.Address = host
+        connection.Port = port
+        result.Connections = append(result.Connections, connection)
+    }
+
+    if used {
+        result.Groups = append(result.Groups, group)
+    }
+
+    return nil
+}
+
+// composeProjectName returns the project name compose derives from a
+// directory name: lowercase letters, digits, dashes and underscores.
+func composeProjectName(dir string) string {
+    var name strings.Builder
+
+    for _, r := range strings.ToLower(dir) {
+        if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+            name.WriteRune(r)
+        }
+    }
+
+    return name.String()
+}
+
+// composeDriver returns the driver of a database image, or "".
+func composeDriver(image string) string {
+    // registry/namespace/name:tag@digest
+    image, _, _ = strings.Cut(image, "@")
+
+    if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+        image = image[:i]
+    }
+
+    image = strings.TrimPrefix(image, "docker.io/")
+    image = strings.TrimPrefix(image, "index.docker.io/")
+    image = strings.TrimPrefix(image, "library/")
+
+    return composeImages[strings.ToLower(image)]
+}
+
+// environment returns the environment of a service: its env_file files,
+// overridden by its environment entries.
+func (s composeService) environment(dir string) (map[string]string, error) {
+    env := make(map[string]string)
+    var files []string
+
+    switch s.EnvFile.Kind {
+    case yaml.ScalarNode:
+        files = append(files, s.EnvFile.Value)
+    case yaml.SequenceNode:
+        for _, item := range s.EnvFile.Content {
+            if item.Kind == yaml.ScalarNode {
+                files = append(files, item.Value)
+                continue
+            }
+
+            var entry struct {
+                Path     string `yaml:"path"`
+                Required *bool  `yaml:"required"`
+            }
+
+            if err := item.Decode(&entry); err != nil {
+                return nil, err
+            }
+
+            if entry.Required != nil && !*entry.Required {
+                if _, err := os.Stat(filepath.Join(dir, entry.Path)); err != nil {
+                    continue
+                }
+            }
+
+            files = append(files, entry.Path)
+        }
+    }
+
+    for _, file := range files {
+        if !filepath.IsAbs(file) {
+            file = filepath.Join(dir, file)
+        }
+
+        data, err := os.ReadFile(file)
+
+        if err != nil {
+            return nil, err
+        }
+
+        env = parseEnvFile(data, env)
+    }
+
+    switch s.Environment.Kind {
+    case yaml.MappingNode:
+        for i := 0; i+1 < len(s.Environment.Content); i += 2 {
+            env[s.Environment.Content[i].Value] = s.Environment.Content[i+1].Value
+        }
+    case yaml.SequenceNode:
+        for _, item := range s.Environment.Content {
+            key, value, ok := strings.Cut(item.Value, "=")
+
+            // KEY alone passes the variable through from the environment
+            if !ok {
+                value = os.Getenv(key)
+            }
+
+            env[key] = value
+        }
+    }
+
+    return env, nil
+}
+
+// parseEnvFile parses KEY=value lines, with optionally quoted values, into
+// env.
+func parseEnvFile(data []byte, env map[string]string) map[string]string {
+    if env == nil {
+        env = make(map[string]string)
+    }
+
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+
+        if !ok {
+            continue
+        }
+
+        value = strings.TrimSpace(value)
+
+        if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+            value = value[1 : len(value)-1]
+        } else if i := strings.Index(value, " #"); i >= 0 {
+            value = strings.TrimSpace(value[:i])
+        }
+
+        env[strings.TrimSpace(key)] = value
+    }
+
+    return env
+}
+
+// composeVariable matches the variable references of a compose file:
+// $$, $VAR, ${VAR} and ${VAR:-default} like forms.
+var composeVariable = regexp.MustCompile(`\$\$|\$([A-Za-z_][A-Za-z0-9_]*)|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?+])((?:[^{}]|\{[^{}]*\})*))?\}`)
+
+// interpolateComposeNode replaces the variable references of the values of
+// a decoded compose file, so that comments are left alone and values can't
+// change the file's structure. Plain values are typed again afterwards, as
+// a port of ${PORT} is a number.
+func interpolateComposeNode(node *yaml.Node, variables map[string]string) error {
+    switch node.Kind {
+    case yaml.ScalarNode:
+        value, err := interpolateCompose(node.Value, variables)
+
+        if err != nil {
+            return err
+        }
+
+        if value != node.Value && node.Style == 0 {
+            node.Tag = ""
+        }
+
+        node.Value = value
+    case yaml.MappingNode:
+        // Keys aren't interpolated
+        for i := 1; i < len(node.Content); i += 2 {
+            if err := interpolateComposeNode(node.Content[i], variables); err != nil {
+                return err
+            }
+        }
+    default:
+        for _, child := range node.Content {
+            if err := interpolateComposeNode(child, variables); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+// interpolateCompose replaces the variable references of a compose value.
+func interpolateCompose(data string, variables map[string]string) (string, error) {
+    var err error
+
+    interpolated := composeVariable.ReplaceAllStringFunc(data, func(match string) string {
+        if match == "$$" {
+            return "$"
+        }
+
+        groups := composeVariable.FindStringSubmatch(match)
+
+        if groups[1] != "" {
+            return variables[groups[1]]
+        }
+
+        name, operator, operand := groups[2], groups[3], groups[4]
+        value, set := variables[name]
+
+        // With a colon, empty counts as unset
+        if strings.HasPrefix(operator, ":") && value == "" {
+            set = false
+        }
+
+        switch strings.TrimPrefix(operator, ":") {
+        case "-":
+            if !set {
+                value, _ = interpolateCompose(operand, variables)
+            }
+        case "?":
+            if !set && err == nil {
+                err = fmt.Errorf("variable %s: %s", name, operand)
+            }
+        case "+":
+            value = ""
+
+            if set {
+                value, _ = interpolateCompose(operand, variables)
+            }
+        }
+
+        return value
+    })
+
+    return interpolated, err
+}
+
+// publishedPort returns the host address and port a container port is
+// published on.
+func publishedPort(ports []any, target int) (string, int, bool) {
+    for _, port := range ports {
+        var hostIP, published, containerPort string
+
+        switch p := port.(type) {
+        case map[string]any:
+            hostIP = fmt.Sprint(p["host_ip"])
+            published = fmt.Sprint(p["published"])
+            containerPort = fmt.Sprint(p["target"])
+
+            if p["host_ip"] == nil {
+                hostIP = ""
+            }
+        default:
+            // [host_ip:][published:]target[/protocol]
+            spec, _, _ := strings.Cut(fmt.Sprint(p), "/")
+            parts := strings.Split(spec, ":")
+
+            if strings.HasPrefix(spec, "[") {
+                // [::1]:5432:5432
+                end := strings.Index(spec, "]")
+                hostIP = spec[1:end]
+                parts = append([]string{hostIP}, strings.Split(strings.TrimPrefix(spec[end+1:], ":"), ":")...)
+            }
+
+            switch len(parts) {
+            case 1:
+                containerPort = parts[0]
+            case 2:
+                published, containerPort = parts[0], parts[1]
+            default:
+                hostIP, published, containerPort = parts[0], parts[1], parts[2]
+            }
+        }
+
+        if containerPort != strconv.Itoa(target) {
+            continue
+        }
+
+        // Ranges, and ports docker picks when the container starts
+        hostPort, err := strconv.Atoi(published)
+
+        if err != nil {
+            return "", 0, false
+        }
+
+        if hostIP == "" || hostIP == "0.0.0.0" || hostIP == "::" {
+            hostIP = "localhost"
+        }
+
+        return hostIP, hostPort, true
+    }
+
+    return "", 0, false
+}
+
+// setComposeCredentials sets the credentials a database container is set
+// up with by the variables of its image.
+func setComposeCredentials(c *AvailableConnection, env map[string]string) {
+    value := func(keys ...string) string { return firstValue(env, keys...) }
+
+    switch c.Driver {
+    case DriverPostgreSQL:
+        c.Username = value("POSTGRES_USER", "POSTGRESQL_USERNAME")
+
+        if c.Username == "" {
+            c.Username = "postgres"
+        }
+
+        c.Password = value("POSTGRES_PASSWORD", "POSTGRESQL_PASSWORD")
+        c.Database = value("POSTGRES_DB", "POSTGRESQL_DATABASE")
+
+        if c.Database == "" {
+            c.Database = c.Username
+        }
+    case DriverMySQL, DriverMariaDB:
+        c.Username = value("MYSQL_USER", "MARIADB_USER")
+        c.Password = value("MYSQL_PASSWORD", "MARIADB_PASSWORD")
+
+        if c.Username == "" {
+            c.Username = "root"
+            c.Password = value("MYSQL_ROOT_PASSWORD", "MARIADB_ROOT_PASSWORD")
+        }
+
+        c.Database = value("MYSQL_DATABASE", "MARIADB_DATABASE")
+    case DriverRedis:
+        c.Password = value("REDIS_PASSWORD")
+    case DriverMongoDB:
+        c.Username = value("MONGO_INITDB_ROOT_USERNAME")
+        c.Password = value("MONGO_INITDB_ROOT_PASSWORD")
+        c.Database = value("MONGO_INITDB_DATABASE")
+    case DriverSQLServer:
+        c.Username = "sa"
+        c.Password = value("MSSQL_SA_PASSWORD", "SA_PASSWORD")
+    }
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+    "fmt"
+    "maps"
+    "os"
+    "path"
+    "path/filepath"
+    "slices"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Config is the config file, holding named export profiles.
+type Config struct {
+    Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile bundles the settings of a recurring export. Unset fields keep the
+// flag defaults, and flags given on the command line win over the profile.
+type Profile struct {
+    Account        string        `yaml:"account"`
+    Accounts       []string      `yaml:"accounts"` // in addition to account
+    Auth           string        `yaml:"auth"`
+    Vaults         []string      `yaml:"vaults"` // only read these vaults
+    Categories     []string      `yaml:"categories"` // read besides Database
+    PickVaults     *bool         `yaml:"pick_vaults"`
+    Cache          *bool         `yaml:"cache"`
+    Verify         *bool         `yaml:"verify"`
+    Source         string        `yaml:"source"`
+    SourcePath     string        `yaml:"source_path"`
+    SourcePassword string        `yaml:"source_password"`
+    SourceKeyFile  string        `yaml:"source_key_file"`
+    SecretRef      string        `yaml:"secret_ref"`
+    All            *bool         `yaml:"all"`
+    Format         string        `yaml:"format"`
+    Output         string        `yaml:"output"`
+    Password       string        `yaml:"password"`
+    Open           *bool         `yaml:"open"`
+    GroupByVault   *bool         `yaml:"group_by_vault"`
+    UngroupedGroup string        `yaml:"ungrouped_group"`
+    Filters        Filters       `yaml:"filters"`
+    Rules          []MappingRule `yaml:"rules"`
+}
+
+// Filters limit which connections are offered. Empty lists match everything,
+// names are matched as globs, everything else is matched case-insensitively.
+type Filters struct {
+    Vaults       []string `yaml:"vaults"`
+    Tags         []string `yaml:"tags"`
+    Names        []string `yaml:"names"`
+    Environments []string `yaml:"environments"`
+    Drivers      []string `yaml:"drivers"`
+}
+
+// MappingRule overrides connection settings for every connection matching
+// all of its conditions. Rules are applied in order.
+type MappingRule struct {
+    Match RuleMatch `yaml:"match"`
+    Set   RuleSet   `yaml:"set"`
+}
+
+// RuleMatch holds the conditions of a MappingRule. Empty conditions match.
+type RuleMatch struct {
+    Vault    string `yaml:"vault"`
+    Tag      string `yaml:"tag"`
+    Name     string `yaml:"name"`     // glob
+    Category string `yaml:"category"` // 1Password category, like login
+}
+
+// RuleSet holds the values a MappingRule sets. Empty values are left alone.
+type RuleSet struct {
+    Driver      string `yaml:"driver"`
+    Environment string `yaml:"environment"`
+    Database    string `yaml:"database"`
+    TLSMode     string `yaml:"tls_mode"`
+}
+
+// configDir returns the directory holding the config and state files,
+// following XDG_CONFIG_HOME and falling back to ~/.config on every platform.
+func configDir() (string, error) {
+    if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+        return filepath.Join(dir, "tableplus-connections"), nil
+    }
+
+    home, err := os.UserHomeDir()
+
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(home, ".config", "tableplus-connections"), nil
+}
+
+// defaultConfigPath returns the location of the config file.
+func defaultConfigPath() (string, error) {
+    dir, err := configDir()
+
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(dir, "config.yaml"), nil
+}
+
+// loadConfig reads and validates a config file.
+func loadConfig(configPath string) (*Config, error) {
+    data, err := os.ReadFile(configPath)
+
+    if err != nil {
+        return nil, err
+    }
+
+    config := &Config{}
+
+    if err := yaml.Unmarshal(data, config); err != nil {
+        return nil, fmt.Errorf("%s: %w", configPath, err)
+    }
+
+    for name, profile := range config.Profiles {
+        if err := profile.validate(); err != nil {
+            return nil, fmt.Errorf("%s: profile %q: %w", configPath, name, err)
+        }
+    }
+
+    return config, nil
+}
+
+// profile looks up a profile by name.
+func (c *Config) profile(name string) (*Profile, error) {
+    profile, ok := c.Profiles[name]
+
+    if !ok || profile == nil {
+        names := slices.Sorted(maps.Keys(c.Profiles))
+
+        return nil, fmt.Errorf("Unknown profile %q, available: %s", name, strings.Join(names, ", "))
+    }
+
+    return profile, nil
+}
+
+func (p *Profile) validate() error {
+    if p.Source != "" && !slices.Contains(sourceNames, p.Source) {
+        return fmt.Errorf("unknown source %q", p.Source)
+    }
+
+    if p.Auth != "" && !slices.Contains(authNames, p.Auth) {
+        return fmt.Errorf("unknown auth %q", p.Auth)
+    }
+
+    if p.Format != "" && !slices.Contains(formatNames, p.Format) {
+        return fmt.Errorf("unknown format %q", p.Format)
+    }
+
+    if _, err := parseCategories(p.Categories); err != nil {
+        return err
+    }
+
+    for _, name := range p.Filters.Names {
+        if _, err := path.Match(name, ""); err != nil {
+            return fmt.Errorf("filter name %q: %w", name, err)
+        }
+    }
+
+    for i, rule := range p.Rules {
+        if _, err := path.Match(rule.Match.Name, ""); err != nil {
+            return fmt.Errorf("rule %d: name %q: %w", i+1, rule.Match.Name, err)
+        }
+
+        if rule.Set.Driver != "" && normalizeDriver(rule.Set.Driver) == "" {
+            return fmt.Errorf("rule %d: unknown driver %q", i+1, rule.Set.Driver)
+        }
+
+        if rule.Set.Environment != "" && normalizeEnvironment(rule.Set.Environment) == "" {
+            return fmt.Errorf("rule %d: unknown environment %q", i+1, rule.Set.Environment)
+        }
+
+        if _, ok := parseTLSMode(rule.Set.TLSMode); rule.Set.TLSMode != "" && !ok {
+            return fmt.Errorf("rule %d: unknown TLS mode %q", i+1, rule.Set.TLSMode)
+        }
+    }
+
+    return nil
+}
+
+// apply copies the profile onto the options, except for the options whose
+// flag was set explicitly.
+func (p *Profile) apply(opts *ExportOptions, explicit map[string]bool) {
+    setString := func(flagName string, dst *string, value string) {
+        if value != "" && !explicit[flagName] {
+            *dst = value
+        }
+    }
+    setBool := func(flagName string, dst *bool, value *bool) {
+        if value != nil && !explicit[flagName] {
+            *dst = *value
+        }
+    }
+
+    // Accounts given as arguments replace the profile's
+    if len(opts.Accounts) == 0 {
+        if p.Account != "" {
+            opts.Accounts = append(opts.Accounts, p.Account)
+        }
+
+        opts.Accounts = append(opts.Accounts, p.Accounts...)
+    }
+
+    setString("auth", &opts.Auth, p.Auth)
+    setString("source", &opts.Source, p.Source)
+    setString("source-path", &opts.SourcePath, expandHome(p.SourcePath))
+    setString("source-password", &opts.SourcePassword, p.SourcePassword)
+    setString("source-key-file", &opts.SourceKeyFile, expandHome(p.SourceKeyFile))
+    setString("secret-ref", &opts.SecretRef, p.SecretRef)
+    setBool("pick-vaults", &opts.PickVaults, p.PickVaults)
+    setBool("cache", &opts.Cache, p.Cache)
+    setBool("verify", &opts.Verify, p.Verify)
+
+    if !explicit["vault"] {
+        opts.Vaults = p.Vaults
+    }
+
+    if !explicit["category"] {
+        opts.Categories = p.Categories
+    }
+    setBool("all", &opts.All, p.All)
+    setString("format", &opts.Format, p.Format)
+    setString("output", &opts.Output, expandHome(p.Output))
+    setString("password", &opts.Password, p.Password)
+    setBool("open", &opts.Open, p.Open)
+    setBool("group-by-vault", &opts.GroupByVault, p.GroupByVault)
+    setString("ungrouped-group", &opts.UngroupedGroup, p.UngroupedGroup)
+
+    opts.Filters = p.Filters
+    opts.Rules = p.Rules
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(p string) string {
+    if p != "~" && !strings.HasPrefix(p, "~/") {
+        return p
+    }
+
+    home, err := os.UserHomeDir()
+
+    if err != nil {
+        return p
+    }
+
+    return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
+
+// filterConnections returns the connections matching the filters.
+func filterConnections(in []*AvailableConnection, filters Filters, groupNames map[string]string) []*AvailableConnection {
+    var out []*AvailableConnection
+
+    for _, c := range in {
+        if matchesFilters(c, filters, groupNames[c.GroupID]) {
+            out = append(out, c)
+        }
+    }
+
+    return out
+}
+
+// filterSkipped returns the skipped items matching the vault and name
+// filters, the only ones that can be checked without a connection.
+func filterSkipped(in []SkippedItem, filters Filters, groupNames map[string]string) []SkippedItem {
+    var out []SkippedItem
+
+    for _, item := range in {
+        c := &AvailableConnection{GroupID: item.GroupID, Name: item.Name}
+
+        if matchesFilters(c, Filters{Vaults: filters.Vaults, Names: filters.Names}, groupNames[item.GroupID]) {
+            out = append(out, item)
+        }
+    }
+
+    return out
+}
+
+func matchesFilters(c *AvailableConnection, filters Filters, groupName string) bool {
+    if len(filters.Vaults) > 0 && !containsFold(filters.Vaults, groupName) && !slices.Contains(filters.Vaults, c.GroupID) {
+        return false
+    }
+
+    if len(filters.Tags) > 0 && !slices.ContainsFunc(c.Tags, func(tag string) bool { return containsFold(filters.Tags, tag) }) {
+        return false
+    }
+
+    if len(filters.Names) > 0 && !slices.ContainsFunc(filters.Names, func(pattern string) bool { return matchGlob(pattern, c.Name) }) {
+        return false
+    }
+
+    if len(filters.Environments) > 0 && !containsFold(filters.Environments, connectionEnvironment(c)) {
+        return false
+    }
+
+    if len(filters.Drivers) > 0 && !containsFold(filters.Drivers, connectionDriver(c)) {
+        return false
+    }
+
+    return true
+}
+
+// applyRules applies the mapping rules to the connections, in place.
+func applyRules(connections []*AvailableConnection, rules []MappingRule, groupNames map[string]string) {
+    for _, c := range connections {
+        for _, rule := range rules {
+            if !rule.Match.matches(c, groupNames[c.GroupID]) {
+                continue
+            }
+
+            if rule.Set.Driver != "" {
+                c.Driver = normalizeDriver(rule.Set.Driver)
+            }
+
+            if rule.Set.Environment != "" {
+                c.Environment = normalizeEnvironment(rule.Set.Environment)
+            }
+
+            if rule.Set.Database != "" {
+                c.Database = rule.Set.Database
+            }
+
+            if mode, ok := parseTLSMode(rule.Set.TLSMode); ok {
+                c.TLSMode = mode
+            }
+        }
+    }
+}
+
+func (r RuleMatch) matches(c *AvailableConnection, groupName string) bool {
+    if r.Vault != "" && !strings.EqualFold(r.Vault, groupName) && r.Vault != c.GroupID {
+        return false
+    }
+
+    if r.Tag != "" && !containsFold(c.Tags, r.Tag) {
+        return false
+    }
+
+    if r.Name != "" && !matchGlob(r.Name, c.Name) {
+        return false
+    }
+
+    if r.Category != "" && normalizeCategory(r.Category) != c.Category {
+        return false
+    }
+
+    return true
+}
+
+// matchGlob matches a name against a glob, case-insensitively.
+func matchGlob(pattern, name string) bool {
+    ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+
+    return ok
+}
+
+// containsFold reports whether the list contains the value, ignoring case.
+func containsFold(list []string, value string) bool {
+    return slices.ContainsFunc(list, func(s string) bool { return strings.EqualFold(s, value) })
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "tableplus-connections/ui"
+)
+
+// Drivers as TablePlus names them in its export format.
+const (
+    DriverPostgreSQL  = "PostgreSQL"
+    DriverMySQL       = "MySQL"
+    DriverMariaDB     = "MariaDB"
+    DriverSQLServer   = "SQLServer"
+    DriverOracle      = "Oracle"
+    DriverSQLite      = "SQLite"
+    DriverRedis       = "Redis"
+    DriverMongoDB     = "MongoDB"
+    DriverRedshift    = "Redshift"
+    DriverCockroachDB = "CockroachDB"
+    DriverClickHouse  = "ClickHouse"
+    DriverSnowflake   = "Snowflake"
+    DriverCassandra   = "Cassandra"
+
+    defaultDriver = DriverPostgreSQL
+)
+
+// Environments as TablePlus names them, used for the connection tag.
+const (
+    EnvironmentLocal       = "local"
+    EnvironmentDevelopment = "development"
+    EnvironmentTesting     = "testing"
+    EnvironmentStaging     = "staging"
+    EnvironmentProduction  = "production"
+
+    defaultEnvironment = EnvironmentLocal
+)
+
+// TLS modes in the order of TablePlus's SSL mode menu.
+const (
+    TLSModeDisable = iota
+    TLSModePrefer
+    TLSModeRequire
+    TLSModeVerifyCA
+    TLSModeVerifyFull
+)
+
+var driverAliases = map[string]string{
+    "postgresql":  DriverPostgreSQL,
+    "postgres":    DriverPostgreSQL,
+    "pg":          DriverPostgreSQL,
+    "mysql":       DriverMySQL,
+    "mariadb":     DriverMariaDB,
+    "mssql":       DriverSQLServer,
+    "sqlserver":   DriverSQLServer,
+    "sql server":  DriverSQLServer,
+    "oracle":      DriverOracle,
+    "sqlite":      DriverSQLite,
+    "redis":       DriverRedis,
+    "mongodb":     DriverMongoDB,
+    "mongo":       DriverMongoDB,
+    "redshift":    DriverRedshift,
+    "cockroachdb": DriverCockroachDB,
+    "cockroach":   DriverCockroachDB,
+    "clickhouse":  DriverClickHouse,
+    "snowflake":   DriverSnowflake,
+    "cassandra":   DriverCassandra,
+}
+
+var environmentAliases = map[string]string{
+    "local":       EnvironmentLocal,
+    "dev":         EnvironmentDevelopment,
+    "development": EnvironmentDevelopment,
+    "test":        EnvironmentTesting,
+    "testing":     EnvironmentTesting,
+    "stage":       EnvironmentStaging,
+    "staging":     EnvironmentStaging,
+    "prod":        EnvironmentProduction,
+    "production":  EnvironmentProduction,
+}
+
+var environmentColors = map[string]string{
+    EnvironmentLocal:       "#007F3D",
+    EnvironmentDevelopment: "#1C6FE2",
+    EnvironmentTesting:     "#8B572A",
+    EnvironmentStaging:     "#F5A623",
+    EnvironmentProduction:  "#C91B1B",
+}
+
+var tlsModeAliases = map[string]int{
+    "disable":     TLSModeDisable,
+    "disabled":    TLSModeDisable,
+    "off":         TLSModeDisable,
+    "false":       TLSModeDisable,
+    "no":          TLSModeDisable,
+    "prefer":      TLSModePrefer,
+    "preferred":   TLSModePrefer,
+    "allow":       TLSModePrefer,
+    "optional":    TLSModePrefer,
+    "require":     TLSModeRequire,
+    "required":    TLSModeRequire,
+    "on":          TLSModeRequire,
+    "true":        TLSModeRequire,
+    "yes":         TLSModeRequire,
+    "mandatory":   TLSModeRequire,
+    "skip-verify": TLSModeRequire,
+    "verify-ca":   TLSModeVerifyCA,
+    "verify_ca":   TLSModeVerifyCA,
+    "verify-full": TLSModeVerifyFull,
+    "verify_full": TLSModeVerifyFull,
+    "verify_identity": TLSModeVerifyFull,
+    "strict":      TLSModeVerifyFull,
+}
+
+var tlsModeNames = map[int]string{
+    TLSModeDisable:    "disable",
+    TLSModePrefer:     "prefer",
+    TLSModeRequire:    "require",
+    TLSModeVerifyCA:   "verify-ca",
+    TLSModeVerifyFull: "verify-full",
+}
+
+// normalizeDriver maps a free-form driver or database type name to the name
+// TablePlus uses. Unknown names return an empty string.
+func normalizeDriver(name string) string {
+    return driverAliases[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// normalizeEnvironment maps a free-form environment name to the name
+// TablePlus uses. Unknown names return an empty string.
+func normalizeEnvironment(name string) string {
+    return environmentAliases[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// parseTLSMode maps a free-form TLS/SSL mode (as used in libpq, MySQL or
+// plain booleans) to a TablePlus TLS mode.
+func parseTLSMode(value string) (int, bool) {
+    mode, ok := tlsModeAliases[strings.ToLower(strings.TrimSpace(value))]
+
+    return mode, ok
+}
+
+// connectionDriver returns the driver of the connection, or the default.
+func connectionDriver(c *AvailableConnection) string {
+    if c.Driver == "" {
+        return defaultDriver
+    }
+
+    return c.Driver
+}
+
+// connectionEnvironment returns the environment of the connection, or the
+// default.
+func connectionEnvironment(c *AvailableConnection) string {
+    if c.Environment == "" {
+        return defaultEnvironment
+    }
+
+    return c.Environment
+}
+
+// AvailableConnection is a connection found in a source, before it is
+// converted to the TablePlus export format.
+type AvailableConnection struct {
+    ID                string
+    GroupID           string
+    Name              string
+    Address           string
+    Port              int
+    Username          string
+    Password          string
+    PasswordIsCommand bool
+    Tags              []string
+    Category          string // 1Password category, like "database" or "login"
+    Driver            string // empty => defaultDriver
+    Database          string
+    Environment       string // empty => defaultEnvironment
+    TLSMode           int
+    SSH               *SSHTunnel // nil => direct connection
+    Account           string     // 1Password account the item was read from
+    UpdatedAt         time.Time
+    ExpiresAt         time.Time // zero => credentials don't expire
+}
+
+// SkippedItem is an item of a source that could not be turned into a
+// connection.
+type SkippedItem struct {
+    ID      string
+    GroupID string
+    Name    string
+    Reason  string
+}
+
+// SourceResult is everything read from a source.
+type SourceResult struct {
+    Connections []*AvailableConnection
+    Groups      []*ui.Group
+    Skipped     []SkippedItem
+
+    // Resolve reads the secrets of the given connections, when Connections
+    // only holds their metadata. Nil when the connections are complete.
+    Resolve func([]*AvailableConnection) ([]*AvailableConnection, error)
+}
+
+// SSHTunnel describes the SSH server a connection is tunneled through.
+type SSHTunnel struct {
+    Host     string
+    Port     int // 0 => 22
+    User     string
+    Password string
+}
+
+// connectionDetails describes the connection for the preview pane of the
+// picker. The password is never included.
+func connectionDetails(c *AvailableConnection) []ui.Detail {
+    password := "••••••••"
+    if c.PasswordIsCommand {
+        password = "(from command)"
+    }
+
+    ssh := "off"
+    if c.SSH != nil {
+        port := c.SSH.Port
+        if port == 0 {
+            port = 22
+        }
+
+        ssh = fmt.Sprintf("%s@%s:%d", c.SSH.User, c.SSH.Host, port)
+    }
+
+    return []ui.Detail{
+        {Label: "Host", Value: c.Address},
+        {Label: "Port", Value: strconv.Itoa(c.Port)},
+        {Label: "User", Value: c.Username},
+        {Label: "Password", Value: password},
+        {Label: "Database", Value: c.Database},
+        {Label: "Driver", Value: connectionDriver(c)},
+        {Label: "Environment", Value: connectionEnvironment(c)},
+        {Label: "SSH", Value: ssh},
+        {Label: "TLS", Value: tlsModeNames[c.TLSMode]},
+    }
+}
+
+// connectionStringKeys are the names of fields holding a connection string
+// or URL, lowercase.
+var connectionStringKeys = []string{"url", "uri", "connection string", "connection url", "database url", "dsn"}
+
+// setConnectionField sets the connection field described by a free-form
+// key, as found in custom fields, notes and secrets: "host", "Port",
+// "ssh user", "url" and the like. It reports whether the key was known.
+func setConnectionField(c *AvailableConnection, key, value string) bool {
+    key = strings.ToLower(strings.TrimSpace(key))
+    key = strings.NewReplacer("_", " ", "-", " ").Replace(key)
+    value = strings.TrimSpace(value)
+
+    switch key {
+    case "host", "hostname", "server", "address", "endpoint":
+        c.Address = value
+    case "port":
+        port, err := strconv.Atoi(value)
+
+        if err != nil {
+            return false
+        }
+
+        c.Port = port
+    case "user", "username", "login":
+        c.Username = value
+    case "password", "pass":
+        c.Password = value
+    case "database", "db", "dbname", "database name":
+        c.Database = value
+    case "driver", "type", "database type", "engine":
+        c.Driver = normalizeDriver(value)
+    case "environment", "env":
+        c.Environment = normalizeEnvironment(value)
+    case "tls mode", "ssl mode", "sslmode", "tls", "ssl":
+        mode, ok := parseTLSMode(value)
+
+        if !ok {
+            return false
+        }
+
+        c.TLSMode = mode
+    case "ssh host", "ssh user", "ssh username", "ssh port", "ssh password":
+        if c.SSH == nil {
+            c.SSH = &SSHTunnel{}
+        }
+
+        switch key {
+        case "ssh host":
+            c.SSH.Host = value
+        case "ssh port":
+            c.SSH.Port, _ = strconv.Atoi(value)
+        case "ssh password":
+            c.SSH.Password = value
+        default:
+            c.SSH.User = value
+        }
+    default:
+        if slices.Contains(connectionStringKeys, key) {
+            return parseConnectionString(value, c)
+        }
+
+        return false
+    }
+
+    return true
+}
+
+// fieldKeyPrefixes are the prefixes of keys like DB_HOST or
+// POSTGRES_PASSWORD, with the driver they imply.
+var fieldKeyPrefixes = []struct {
+    Prefix string
+    Driver string
+}{
+    {"database ", ""},
+    {"db ", ""},
+    {"postgresql ", DriverPostgreSQL},
+    {"postgres ", DriverPostgreSQL},
+    {"pg", DriverPostgreSQL}, // PGHOST, PGUSER
+    {"mysql ", DriverMySQL},
+    {"mariadb ", DriverMariaDB},
+    {"mongodb ", DriverMongoDB},
+    {"mongo ", DriverMongoDB},
+    {"redis ", DriverRedis},
+    {"mssql ", DriverSQLServer},
+}
+
+// setPrefixedField sets the field of a connection a key names, like
+// setConnectionField, but also when the key is prefixed, like DB_HOST,
+// PGUSER or MYSQL_PASSWORD.
+func setPrefixedField(c *AvailableConnection, key, value string) {
+    if setConnectionField(c, key, value) {
+        return
+    }
+
+    key = strings.ToLower(strings.NewReplacer("_", " ", "-", " ", ".", " ").Replace(key))
+
+    // jdbc-uri, as CloudNativePG and Crunchy Data's operator write
+    if strings.HasPrefix(key, "jdbc ") {
+        key = strings.TrimPrefix(key, "jdbc ")
+    }
+
+    for _, prefix := range fieldKeyPrefixes {
+        name, ok := strings.CutPrefix(key, prefix.Prefix)
+
+        if !ok || name == "" {
+            continue
+        }
+
+        // The libpq variables, but not pgpass or pgbouncer keys
+        if prefix.Prefix == "pg" && !slices.Contains([]string{"host", "port", "user", "password", "database"}, name) {
+            continue
+        }
+
+        if setConnectionField(c, name, value) {
+            if c.Driver == "" {
+                c.Driver = prefix.Driver
+            }
+
+            return
+        }
+    }
+
+    setConnectionField(c, key, value)
+}
+
+// isConnectionStringKey reports whether a key names a connection string,
+// like setPrefixedField maps them.
+func isConnectionStringKey(key string) bool {
+    key = strings.ToLower(strings.NewReplacer("_", " ", "-", " ", ".", " ").Replace(key))
+    key = strings.TrimPrefix(key, "jdbc ")
+
+    return slices.Contains(connectionStringKeys, key)
+}
+
+// pathGroup returns the group of a directory in a source laid out as a
+// tree, adding it and the directories above it to groups.
+func pathGroup(prefix, dir string, groups map[string]*ui.Group) *ui.Group {
+    if group, ok := groups[dir]; ok {
+        return group
+    }
+
+    group := &ui.Group{ID: prefix + dir + "/", Name: dir}
+
+    if parent := path.Dir(dir); parent != "." && parent != "/" {
+        group.ParentID = pathGroup(prefix, parent, groups).ID
+    }
+
+    groups[dir] = group
+
+    return group
+}
+
+// describesDatabase reports whether the fields a source set describe a
+// database, rather than only credentials.
+func describesDatabase(c *AvailableConnection) bool {
+    return c.Address != "" || c.Port != 0 || c.Driver != "" || c.Database != ""
+}
+
+// completeConnection fills in the defaults of a connection read from a
+// source, and lists the fields it needs to be exported that it doesn't
+// have, for SkippedItem.Reason.
+func completeConnection(c *AvailableConnection) []string {
+    var missing []string
+
+    if c.Address == "" && c.Driver != DriverSQLite {
+        missing = append(missing, "hostname")
+    }
+
+    if c.Port == 0 && c.Driver != DriverSQLite {
+        if port, ok := defaultPorts[connectionDriver(c)]; ok {
+            c.Port = port
+        } else {
+            missing = append(missing, "port")
+        }
+    }
+
+    if c.SSH != nil && c.SSH.Host == "" {
+        c.SSH = nil
+    }
+
+    return missing
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "slices"
+    "strings"
+    "time"
+
+    "github.com/RNCryptor/RNCryptor-go"
+
+    "tableplus-connections/ui"
+)
+
+// Names accepted by --source and --format.
+var sourceNames = []string{"1password", "bitwarden", "keepass", "pass", "vault", "manifest", "pgpass", "pgservice", "mysql", "cli", "compose", "kubernetes", "terraform"}
+var formatNames = []string{"tableplus", "json"}
+
+// sources maps the names in sourceNames to the functions reading them.
+var sources = map[string]func(ExportOptions) (*SourceResult, error){
+    "1password":  loadOnePassword,
+    "bitwarden":  loadBitwarden,
+    "keepass":    loadKeePass,
+    "pass":       loadPass,
+    "vault":      loadVault,
+    "manifest":   loadManifest,
+    "pgpass":     loadPgpass,
+    "pgservice":  loadPgService,
+    "mysql":      loadMySQLOptions,
+    "cli":        loadCLIConfig,
+    "compose":    loadCompose,
+    "kubernetes": loadKubernetes,
+    "terraform":  loadTerraform,
+}
+
+// ExportOptions holds everything an export run is configured with, from
+// flags and profiles.
+type ExportOptions struct {
+    Accounts       []string
+    Auth           string
+    Vaults         []string // allow-list of vault names or IDs
+    Categories     []string // 1Password categories read besides Database
+    PickVaults     bool
+    Cache          bool
+    RefreshCache   bool
+    CacheMaxAge    time.Duration
+
+    // Offer connections from item overviews and cached metadata without
+    // reading their items, which are read by SourceResult.Resolve once
+    // picked. Set by export, not a flag.
+    MetadataOnly   bool
+
+    Verify         bool
+    Check          CheckOptions
+    Source         string
+    SourcePath     string // file or directory read by file based sources
+    SourcePassword string // unlocks an encrypted source file
+    SourceKeyFile  string // unlocks a KeePass database, with or without SourcePassword
+    SecretRef      string // 1Password item of a connection's credentials, {name} being its name
+    All            bool
+    Format         string
+    Output         string
+    Password       string
+    Open           bool
+    GroupByVault   bool
+    UngroupedGroup string
+    NoState        bool
+    Filters        Filters
+    Rules          []MappingRule
+
+    // Where the options came from, not part of a profile
+    Profile        string
+    ConfigPath     string
+}
+
+// stringList is a flag that can be repeated, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string {
+    return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+    *l = append(*l, value)
+    return nil
+}
+
+// addSourceFlags registers the flags selecting where connections are read
+// from, shared by every command reading a source.
+func addSourceFlags(fs *flag.FlagSet, opts *ExportOptions) {
+    sourceUsage := "Where to read connections from: " + strings.Join(sourceNames, ", ")
+    const profileUsage = "Name of a profile in the config file to use"
+    const configUsage = "Config file path (default ~/.config/tableplus-connections/config.yaml)"
+
+    authUsage := "1Password authentication: " + strings.Join(authNames, ", ") + " (auto uses the service account when " + serviceAccountTokenEnv + " is set)"
+
+    fs.StringVar(&opts.Source, "source", "1password", sourceUsage)
+    fs.StringVar(&opts.SourcePath, "source-path", "", "File or directory to read connections from, for file based sources")
+    fs.StringVar(&opts.SourcePassword, "source-password", "", "Password of an encrypted source file")
+    fs.StringVar(&opts.SourceKeyFile, "source-key-file", "", "Key file of a KeePass database")
+    fs.StringVar(&opts.SecretRef, "secret-ref", "", "1Password item holding the credentials of terraform connections, like op://Infra/{name}")
+    fs.StringVar(&opts.Auth, "auth", AuthAuto, authUsage)
+    fs.Var((*stringList)(&opts.Vaults), "vault", "Only read this vault, by name or ID (repeatable)")
+    fs.BoolVar(&opts.PickVaults, "pick-vaults", false, "Pick the vaults to read interactively first")
+    fs.Var((*stringList)(&opts.Categories), "category", "Also read 1Password items of this category: "+strings.Join(categoryNames, ", ")+" (repeatable)")
+    fs.BoolVar(&opts.Cache, "cache", false, "Show the host, driver and such of items from an encrypted cache of their metadata")
+    fs.BoolVar(&opts.RefreshCache, "refresh-cache", false, "Read every item and rebuild the metadata cache")
+    fs.DurationVar(&opts.CacheMaxAge, "cache-max-age", defaultCacheMaxAge, "Rebuild the metadata cache when it is older than this")
+    fs.StringVar(&opts.Profile, "profile", "", profileUsage)
+    fs.StringVar(&opts.ConfigPath, "config", "", configUsage)
+}
+
+// addExportFlags registers the flags of the export command.
+func addExportFlags(fs *flag.FlagSet, opts *ExportOptions) {
+    const allUsage = "Export all connections, without interactive input"
+    const groupByVaultUsage = "Create a group for each vault of the exported items"
+    const outputUsage = "Output filename, without extension"
+    const passwordUsage = "Export password"
+    const openUsage = "Open the export immediately"
+    const noStateUsage = "Don't pre-select the previous selection, and don't remember this one"
+    const ungroupedGroupUsage = "With --group-by-vault, put connections without a vault in a group with this name instead of at the top level"
+    const formatUsage = "Export format: tableplus (encrypted .tableplusconnection) or json (unencrypted .json)"
+
+    addSourceFlags(fs, opts)
+
+    fs.BoolVar(&opts.All, "all", false, allUsage)
+    fs.BoolVar(&opts.All, "a", false, allUsage + " (shorthand)")
+
+    fs.BoolVar(&opts.GroupByVault, "group-by-vault", false, groupByVaultUsage)
+    fs.StringVar(&opts.UngroupedGroup, "ungrouped-group", "", ungroupedGroupUsage)
+
+    fs.StringVar(&opts.Output, "output", "export", outputUsage)
+    fs.StringVar(&opts.Output, "o", "export", outputUsage + " (shorthand)")
+
+    fs.StringVar(&opts.Password, "password", "password", passwordUsage)
+    fs.StringVar(&opts.Password, "p", "password", passwordUsage + " (shorthand)")
+
+    fs.StringVar(&opts.Format, "format", "tableplus", formatUsage)
+
+    fs.BoolVar(&opts.Open, "open", false, openUsage)
+    fs.BoolVar(&opts.NoState, "no-state", false, noStateUsage)
+
+    fs.BoolVar(&opts.Verify, "verify", false, "Check every picked connection first, leaving out those whose credentials are rejected")
+    addCheckFlags(fs, &opts.Check)
+}
+
+// resolveOptions fills in the positional accounts and applies the profile
+// given with --profile, after fs has been parsed.
+func resolveOptions(fs *flag.FlagSet, opts *ExportOptions) error {
+    opts.Accounts = fs.Args()
+
+    if opts.Profile == "" {
+        return nil
+    }
+
+    configPath := opts.ConfigPath
+
+    if configPath == "" {
+        var err error
+        configPath, err = defaultConfigPath()
+
+        if err != nil {
+            return err
+        }
+    }
+
+    config, err := loadConfig(configPath)
+
+    if err != nil {
+        return err
+    }
+
+    profile, err := config.profile(opts.Profile)
+
+    if err != nil {
+        return err
+    }
+
+    explicit := make(map[string]bool)
+
+    fs.Visit(func(f *flag.Flag) {
+        explicit[f.Name] = true
+    })
+
+    // Shorthands count as their long flag
+    for short, long := range map[string]string{"a": "all", "o": "output", "p": "password"} {
+        explicit[long] = explicit[long] || explicit[short]
+    }
+
+    profile.apply(opts, explicit)
+
+    return nil
+}
+
+func exportCommand(args []string) error {
+    var opts ExportOptions
+
+    fs := newFlagSet("export", "[accounts...]", "Pick connections and write a TablePlus export (the default command)")
+    addExportFlags(fs, &opts)
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if err := resolveOptions(fs, &opts); err != nil {
+        return err
+    }
+
+    return runExport(opts)
+}
+
+// loadConnections reads the connections from the configured source, with
+// the profile's mapping rules and filters applied.
+func loadConnections(opts ExportOptions) (*SourceResult, error) {
+    load, ok := sources[opts.Source]
+
+    if !ok {
+        return nil, fmt.Errorf("Unknown source %q", opts.Source)
+    }
+
+    result, err := load(opts)
+
+    if (err != nil) {
+        return nil, err
+    }
+
+    groupNames := groupNameMap(result.Groups)
+
+    applyRules(result.Connections, opts.Rules, groupNames)
+    result.Connections = filterConnections(result.Connections, opts.Filters, groupNames)
+    result.Skipped = filterSkipped(result.Skipped, opts.Filters, groupNames)
+
+    return result, nil
+}
+
+// groupNameMap maps group IDs to their names.
+func groupNameMap(groups []*ui.Group) map[string]string {
+    names := make(map[string]string, len(groups))
+
+    for _, group := range groups {
+        names[group.ID] = group.Name
+    }
+
+    return names
+}
+
+// runExport reads the connections, lets the user pick (unless opts.All is
+// set) and writes the export.
+func runExport(opts ExportOptions) error {
+    if !slices.Contains(formatNames, opts.Format) {
+        return fmt.Errorf("Unknown format %q", opts.Format)
+    }
+
+    exportable, source, err := selectConnections(opts)
+
+    if err != nil {
+        return err
+    }
+
+    if opts.Verify {
+        results := checkConnections(exportable, opts.Check)
+
+        if err := writeCheckResults(os.Stdout, results); err != nil {
+            return err
+        }
+
+        exportable = nil
+
+        for _, result := range results {
+            if result.Status == CheckAuthFailed {
+                fmt.Fprintf(os.Stderr, "Leaving out %s: %s\n", result.Connection.Name, result.Detail)
+                continue
+            }
+
+            // The credentials weren't tried, the tunnel's failure is local
+            if result.Status == CheckSSHFailed {
+                fmt.Fprintf(os.Stderr, "Keeping %s, its credentials are unchecked: %s\n", result.Connection.Name, result.Detail)
+            }
+
+            exportable = append(exportable, result.Connection)
+        }
+    }
+
+    warnExpiringCredentials(exportable)
+
+    var out any
+
+    if opts.GroupByVault {
+        out = convertGroupedConnections(exportable, source.Groups, opts.UngroupedGroup)
+    } else {
+        out = convertConnections(exportable)
+    }
+
+    outputFile, err := writeExport(out, opts.Output, opts.Format, opts.Password)
+
+    if (err != nil) {
+        return err
+    }
+
+    if opts.Open {
+        fmt.Println("Opening")
+
+        return openWithApp("TablePlus", outputFile)
+    }
+
+    fmt.Println("Exported")
+
+    return nil
+}
+
+// warnExpiringCredentials tells which of the exported credentials expire,
+// like dynamic credentials leased from Vault.
+func warnExpiringCredentials(connections []*AvailableConnection) {
+    for _, connection := range connections {
+        if connection.ExpiresAt.IsZero() {
+            continue
+        }
+
+        fmt.Fprintf(os.Stderr, "Credentials of %s expire in %s, at %s\n", connection.Name,
+            time.Until(connection.ExpiresAt).Round(time.Minute), connection.ExpiresAt.Format(time.DateTime))
+    }
+}
+
+// selectConnections reads the connections and lets the user pick, unless
+// opts.All is set. The picked connections are returned with their secrets.
+func selectConnections(opts ExportOptions) ([]*AvailableConnection, *SourceResult, error) {
+    // Only read the items of the connections that are picked. Filtering on
+    // environment or driver needs the fields, so it reads everything, as
+    // rebuilding the cache does.
+    opts.MetadataOnly = !opts.All && !opts.RefreshCache && len(opts.Filters.Environments) == 0 && len(opts.Filters.Drivers) == 0
+
+    source, err := loadConnections(opts)
+
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var selected []*AvailableConnection
+
+    if opts.All {
+        selected = source.Connections
+    } else {
+        selected, err = pickConnections(source.Connections, source.Groups, opts)
+
+        if err != nil {
+            return nil, nil, err
+        }
+    }
+
+    if source.Resolve != nil {
+        selected, err = source.Resolve(selected)
+
+        if err != nil {
+            return nil, nil, err
+        }
+
+        groupNames := groupNameMap(source.Groups)
+
+        applyRules(selected, opts.Rules, groupNames)
+        selected = filterConnections(selected, opts.Filters, groupNames)
+    }
+
+    return selected, source, nil
+}
+
+// exportFileName returns the name of the file an export is written to, the
+// output with the extension of the format.
+func exportFileName(output, format string) string {
+    if format == "json" {
+        return output + ".json"
+    }
+
+    return output + ".tableplusconnection"
+}
+
+// writeExport writes the export in the given format, adding the format's
+// extension to output, and returns the path written to.
+func writeExport(out any, output, format, password string) (string, error) {
+    jsonString, err := json.MarshalIndent(out, "", "  ")
+
+    if (err != nil) {
+        return "", err
+    }
+
+    outputFile := exportFileName(output, format)
+    contents := jsonString
+
+    if format != "json" {
+        contents, err = rncryptor.Encrypt(password, jsonString)
+
+        if (err != nil) {
+            return "", err
+        }
+    }
+
+    return outputFile, os.WriteFile(outputFile, contents, 0666)
+}
+
+// pickConnections runs the picker, pre-selecting the previous selection of
+// the account, and returns the selected connections.
+func pickConnections(connections []*AvailableConnection, groups []*ui.Group, opts ExportOptions) ([]*AvailableConnection, error) {
+    var selectable []ui.Item
+    var state *StateFile
+    var err error
+    previous := &SelectionState{Grouped: true}
+
+    if !opts.NoState {
+        state, err = loadState()
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Ignoring previous selection: %s\n", err)
+            state = nil
+        } else if s, ok := state.Accounts[stateKey(opts)]; ok {
+            previous = s
+        }
+    }
+
+    for _, connection := range connections {
+        selectable = append(selectable, ui.Item{
+            ID: connection.ID,
+            TitleText: connection.Name,
+            DescriptionText: connection.Address,
+            GroupID: connection.GroupID,
+            Tags: connection.Tags,
+            Environment: connectionEnvironment(connection),
+            Details: connectionDetails(connection),
+            Selected: true,
+        })
+    }
+
+    // Without a previous run everything is selected. Otherwise restore
+    // the previous selection, and mark items we haven't seen before.
+    if previous.Known != nil {
+        for i := range selectable {
+            selectable[i].Selected = slices.Contains(previous.Selected, selectable[i].ID)
+            selectable[i].New = !slices.Contains(previous.Known, selectable[i].ID)
+        }
+    }
+
+    result, err := ui.Run(selectable, groups, ui.Options{Grouped: previous.Grouped})
+
+    if err != nil {
+        return nil, err
+    }
+
+    var selectedIds []string
+
+    for _, item := range result.Selected {
+        selectedIds = append(selectedIds, item.ID)
+    }
+
+    if state != nil {
+        known := make([]string, 0, len(selectable))
+
+        for _, item := range selectable {
+            known = append(known, item.ID)
+        }
+
+        state.Accounts[stateKey(opts)] = &SelectionState{
+            Selected:  selectedIds,
+            Known:     known,
+            Grouped:   result.Grouped,
+            UpdatedAt: time.Now(),
+        }
+
+        if err := saveState(state); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not remember selection: %s\n", err)
+        }
+    }
+
+    var exportable []*AvailableConnection
+
+    for _, connection := range connections {
+        if slices.Contains(selectedIds, connection.ID) {
+            exportable = append(exportable, connection)
+        }
+    }
+
+    return exportable, nil
+}
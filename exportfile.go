@@ -0,0 +1,98 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+
+    "github.com/RNCryptor/RNCryptor-go"
+)
+
+// ExportEntry is a connection read back from an export, with the name of
+// the group it was in (empty at the top level).
+type ExportEntry struct {
+    Group      string
+    Connection *OutputConnection
+}
+
+// readExportFile returns the JSON of an export, decrypting it with the
+// password unless it is a plain JSON export.
+func readExportFile(path, password string) ([]byte, error) {
+    data, err := os.ReadFile(path)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if json.Valid(data) {
+        return data, nil
+    }
+
+    decrypted, err := rncryptor.Decrypt(password, data)
+
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+
+    return decrypted, nil
+}
+
+// parseExport parses the JSON of an export, flat or grouped, into its
+// connections.
+func parseExport(data []byte) ([]ExportEntry, error) {
+    var raw []map[string]json.RawMessage
+
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return nil, err
+    }
+
+    var entries []ExportEntry
+
+    for i, object := range raw {
+        encoded, err := json.Marshal(object)
+
+        if err != nil {
+            return nil, err
+        }
+
+        if _, isGroup := object["connections"]; !isGroup {
+            connection := &OutputConnection{}
+
+            if err := json.Unmarshal(encoded, connection); err != nil {
+                return nil, fmt.Errorf("entry %d: %w", i+1, err)
+            }
+
+            entries = append(entries, ExportEntry{Connection: connection})
+            continue
+        }
+
+        group := &OutputGroup{}
+
+        if err := json.Unmarshal(encoded, group); err != nil {
+            return nil, fmt.Errorf("entry %d: %w", i+1, err)
+        }
+
+        for _, connection := range group.Connections {
+            entries = append(entries, ExportEntry{Group: group.Name, Connection: connection})
+        }
+    }
+
+    return entries, nil
+}
+
+// loadExport reads and parses an export file.
+func loadExport(path, password string) ([]ExportEntry, error) {
+    data, err := readExportFile(path, password)
+
+    if err != nil {
+        return nil, err
+    }
+
+    entries, err := parseExport(data)
+
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+
+    return entries, nil
+}
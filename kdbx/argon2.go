@@ -0,0 +1,308 @@
+package kdbx
+
+import (
+    "encoding/binary"
+    "hash"
+    "math/bits"
+    "sync"
+
+    "golang.org/x/crypto/blake2b"
+)
+
+// golang.org/x/crypto/argon2 only implements Argon2i and Argon2id, while
+// KeePass defaults to Argon2d. This is the same algorithm (version 0x13)
+// for both d and id.
+
+const (
+    argon2d  = 0
+    argon2id = 2
+
+    argon2Version = 0x13
+    blockLength   = 128 // uint64s per 1 KiB block
+    syncPoints    = 4
+)
+
+type block [blockLength]uint64
+
+// argon2Key derives a key of keyLen bytes. memory is in KiB.
+func argon2Key(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+    if memory < 2*syncPoints*uint32(threads) {
+        memory = 2 * syncPoints * uint32(threads)
+    }
+
+    h0 := argon2H0(mode, password, salt, secret, data, time, memory, uint32(threads), keyLen)
+    memory = memory / (syncPoints * uint32(threads)) * (syncPoints * uint32(threads))
+    B := argon2InitBlocks(h0, memory, uint32(threads))
+    argon2ProcessBlocks(B, time, memory, uint32(threads), mode)
+
+    return argon2Extract(B, memory, uint32(threads), keyLen)
+}
+
+func argon2H0(mode int, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) []byte {
+    b2, _ := blake2b.New512(nil)
+    var params [24]byte
+
+    binary.LittleEndian.PutUint32(params[0:], threads)
+    binary.LittleEndian.PutUint32(params[4:], keyLen)
+    binary.LittleEndian.PutUint32(params[8:], memory)
+    binary.LittleEndian.PutUint32(params[12:], time)
+    binary.LittleEndian.PutUint32(params[16:], argon2Version)
+    binary.LittleEndian.PutUint32(params[20:], uint32(mode))
+    b2.Write(params[:])
+
+    for _, input := range [][]byte{password, salt, secret, data} {
+        var length [4]byte
+        binary.LittleEndian.PutUint32(length[:], uint32(len(input)))
+        b2.Write(length[:])
+        b2.Write(input)
+    }
+
+    return b2.Sum(nil)
+}
+
+func argon2InitBlocks(h0 []byte, memory, threads uint32) []block {
+    B := make([]block, memory)
+    input := make([]byte, len(h0)+8)
+    copy(input, h0)
+    var out [1024]byte
+
+    for lane := uint32(0); lane < threads; lane++ {
+        j := lane * (memory / threads)
+        binary.LittleEndian.PutUint32(input[len(h0)+4:], lane)
+
+        for i := uint32(0); i < 2; i++ {
+            binary.LittleEndian.PutUint32(input[len(h0):], i)
+            argon2Hash(out[:], input)
+
+            for k := range B[j+i] {
+                B[j+i][k] = binary.LittleEndian.Uint64(out[k*8:])
+            }
+        }
+    }
+
+    return B
+}
+
+func argon2ProcessBlocks(B []block, time, memory, threads uint32, mode int) {
+    lanes := memory / threads
+    segments := lanes / syncPoints
+
+    processSegment := func(n, slice, lane uint32, wg *sync.WaitGroup) {
+        defer wg.Done()
+
+        var addresses, in, zero block
+        independent := mode == argon2id && n == 0 && slice < syncPoints/2
+
+        if independent {
+            in[0] = uint64(n)
+            in[1] = uint64(lane)
+            in[2] = uint64(slice)
+            in[3] = uint64(memory)
+            in[4] = uint64(time)
+            in[5] = uint64(mode)
+        }
+
+        index := uint32(0)
+
+        if n == 0 && slice == 0 {
+            index = 2 // the first two blocks are initialized from h0
+
+            if independent {
+                in[6]++
+                argon2Compress(&addresses, &in, &zero, false)
+                argon2Compress(&addresses, &addresses, &zero, false)
+            }
+        }
+
+        offset := lane*lanes + slice*segments + index
+
+        for index < segments {
+            prev := offset - 1
+
+            if index == 0 && slice == 0 {
+                prev += lanes // last block of the lane
+            }
+
+            var random uint64
+
+            if independent {
+                if index%blockLength == 0 {
+                    in[6]++
+                    argon2Compress(&addresses, &in, &zero, false)
+                    argon2Compress(&addresses, &addresses, &zero, false)
+                }
+
+                random = addresses[index%blockLength]
+            } else {
+                random = B[prev][0]
+            }
+
+            ref := argon2Index(random, lanes, segments, threads, n, slice, lane, index)
+            argon2Compress(&B[offset], &B[prev], &B[ref], true)
+            index, offset = index+1, offset+1
+        }
+    }
+
+    for n := uint32(0); n < time; n++ {
+        for slice := uint32(0); slice < syncPoints; slice++ {
+            var wg sync.WaitGroup
+
+            for lane := uint32(0); lane < threads; lane++ {
+                wg.Add(1)
+                go processSegment(n, slice, lane, &wg)
+            }
+
+            wg.Wait()
+        }
+    }
+}
+
+// argon2Index picks the reference block for the block at index in the
+// segment of slice and lane.
+func argon2Index(random uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+    refLane := uint32(random>>32) % threads
+
+    if n == 0 && slice == 0 {
+        refLane = lane
+    }
+
+    m, s := 3*segments, ((slice+1)%syncPoints)*segments
+
+    if lane == refLane {
+        m += index
+    }
+
+    if n == 0 {
+        m, s = slice*segments, 0
+
+        if slice == 0 || lane == refLane {
+            m += index
+        }
+    }
+
+    if index == 0 || lane == refLane {
+        m--
+    }
+
+    p := random & 0xFFFFFFFF
+    p = (p * p) >> 32
+    p = (p * uint64(m)) >> 32
+
+    return refLane*lanes + uint32((uint64(s)+uint64(m)-(p+1))%uint64(lanes))
+}
+
+func argon2Extract(B []block, memory, threads, keyLen uint32) []byte {
+    lanes := memory / threads
+
+    for lane := uint32(0); lane < threads-1; lane++ {
+        for i, v := range B[(lane*lanes)+lanes-1] {
+            B[memory-1][i] ^= v
+        }
+    }
+
+    var buf [1024]byte
+
+    for i, v := range B[memory-1] {
+        binary.LittleEndian.PutUint64(buf[i*8:], v)
+    }
+
+    key := make([]byte, keyLen)
+    argon2Hash(key, buf[:])
+
+    return key
+}
+
+// argon2Hash is the variable length hash H' of the Argon2 specification.
+func argon2Hash(out, in []byte) {
+    var length [4]byte
+    binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+
+    newHash := func(size int) hash.Hash {
+        h, _ := blake2b.New(size, nil)
+        return h
+    }
+
+    if len(out) <= blake2b.Size {
+        h := newHash(len(out))
+        h.Write(length[:])
+        h.Write(in)
+        h.Sum(out[:0])
+        return
+    }
+
+    h := newHash(blake2b.Size)
+    h.Write(length[:])
+    h.Write(in)
+    v := h.Sum(nil)
+    copy(out, v[:32])
+    out = out[32:]
+
+    for len(out) > blake2b.Size {
+        h.Reset()
+        h.Write(v)
+        v = h.Sum(v[:0])
+        copy(out, v[:32])
+        out = out[32:]
+    }
+
+    h = newHash(len(out))
+    h.Write(v)
+    h.Sum(out[:0])
+}
+
+// argon2Compress is the compression function G, XORed into out when xor is
+// set (every pass but the first one of version 0x13, where out is zero).
+func argon2Compress(out, in1, in2 *block, xor bool) {
+    var t block
+
+    for i := range t {
+        t[i] = in1[i] ^ in2[i]
+    }
+
+    for i := 0; i < blockLength; i += 16 {
+        blamka(&t, i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10, i+11, i+12, i+13, i+14, i+15)
+    }
+
+    for i := 0; i < blockLength/8; i += 2 {
+        blamka(&t, i, i+1, 16+i, 16+i+1, 32+i, 32+i+1, 48+i, 48+i+1,
+            64+i, 64+i+1, 80+i, 80+i+1, 96+i, 96+i+1, 112+i, 112+i+1)
+    }
+
+    for i := range t {
+        v := in1[i] ^ in2[i] ^ t[i]
+
+        if xor {
+            out[i] ^= v
+        } else {
+            out[i] = v
+        }
+    }
+}
+
+// blamka is the BLAKE2b round function with the multiplications Argon2 adds,
+// on the 16 words of t at the given indexes.
+func blamka(t *block, i ...int) {
+    gb := func(a, b, c, d int) {
+        va, vb, vc, vd := t[i[a]], t[i[b]], t[i[c]], t[i[d]]
+
+        va += vb + 2*uint64(uint32(va))*uint64(uint32(vb))
+        vd = bits.RotateLeft64(vd^va, -32)
+        vc += vd + 2*uint64(uint32(vc))*uint64(uint32(vd))
+        vb = bits.RotateLeft64(vb^vc, -24)
+        va += vb + 2*uint64(uint32(va))*uint64(uint32(vb))
+        vd = bits.RotateLeft64(vd^va, -16)
+        vc += vd + 2*uint64(uint32(vc))*uint64(uint32(vd))
+        vb = bits.RotateLeft64(vb^vc, -63)
+
+        t[i[a]], t[i[b]], t[i[c]], t[i[d]] = va, vb, vc, vd
+    }
+
+    gb(0, 4, 8, 12)
+    gb(1, 5, 9, 13)
+    gb(2, 6, 10, 14)
+    gb(3, 7, 11, 15)
+    gb(0, 5, 10, 15)
+    gb(1, 6, 11, 12)
+    gb(2, 7, 8, 13)
+    gb(3, 4, 9, 14)
+}
@@ -0,0 +1,61 @@
+package kdbx
+
+import (
+    "bytes"
+    "encoding/hex"
+    "testing"
+
+    "golang.org/x/crypto/argon2"
+)
+
+// The test vectors of RFC 9106, section 5.
+func TestArgon2RFC9106(t *testing.T) {
+    password := bytes.Repeat([]byte{0x01}, 32)
+    salt := bytes.Repeat([]byte{0x02}, 16)
+    secret := bytes.Repeat([]byte{0x03}, 8)
+    data := bytes.Repeat([]byte{0x04}, 12)
+
+    tests := []struct {
+        name string
+        mode int
+        tag  string
+    }{
+        {"Argon2d", argon2d, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+        {"Argon2id", argon2id, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            tag := argon2Key(test.mode, password, salt, secret, data, 3, 32, 4, 32)
+
+            if got := hex.EncodeToString(tag); got != test.tag {
+                t.Errorf("tag = %s, want %s", got, test.tag)
+            }
+        })
+    }
+}
+
+// Argon2id is checked against golang.org/x/crypto/argon2, which doesn't take
+// a secret or associated data.
+func TestArgon2idMatchesXCrypto(t *testing.T) {
+    tests := []struct {
+        time, memory uint32
+        threads      uint8
+        keyLen       uint32
+    }{
+        {1, 64, 1, 32},
+        {2, 256, 2, 32},
+        {3, 1024, 4, 64},
+        {1, 100, 3, 16}, // memory not a multiple of 4 * threads
+    }
+
+    for _, test := range tests {
+        password, salt := []byte("password"), []byte("somesaltsomesalt")
+        want := argon2.IDKey(password, salt, test.time, test.memory, test.threads, test.keyLen)
+        got := argon2Key(argon2id, password, salt, nil, nil, test.time, test.memory, test.threads, test.keyLen)
+
+        if !bytes.Equal(got, want) {
+            t.Errorf("%+v: key = %x, want %x", test, got, want)
+        }
+    }
+}
@@ -0,0 +1,375 @@
+// Package kdbx reads KeePass databases in the KDBX 4 format: the group tree
+// and the string fields of its entries.
+package kdbx
+
+import (
+    "bytes"
+    "compress/gzip"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+
+    "golang.org/x/crypto/chacha20"
+)
+
+var ErrCredentials = errors.New("wrong password or key file")
+
+// Database is a decrypted KeePass database.
+type Database struct {
+    Root       *Group
+    RecycleBin string // UUID of the recycle bin group, empty without one
+}
+
+// Group is a group of entries and subgroups.
+type Group struct {
+    UUID    string
+    Name    string
+    Notes   string
+    Groups  []*Group
+    Entries []*Entry
+}
+
+// Entry is an entry with its string fields, the standard ones (Title,
+// UserName, Password, URL, Notes) and custom ones, protected or not.
+type Entry struct {
+    UUID   string
+    Fields map[string]string
+    Tags   []string
+}
+
+const (
+    signature1 = 0x9AA2D903
+    signature2 = 0xB54BFB67
+)
+
+// Outer header fields.
+const (
+    headerEnd         = 0
+    headerCipherID    = 2
+    headerCompression = 3
+    headerMasterSeed  = 4
+    headerIV          = 7
+    headerKdfParams   = 11
+)
+
+var (
+    cipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+    cipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+
+    kdfAES      = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+    kdfArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+    kdfArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+type header struct {
+    cipherID   []byte
+    compressed bool
+    masterSeed []byte
+    iv         []byte
+    kdf        map[string][]byte
+}
+
+// Open decrypts a database with a password, the contents of a key file, or
+// both. An empty password or a nil key file isn't used.
+func Open(r io.Reader, password string, keyFile []byte) (*Database, error) {
+    data, err := io.ReadAll(r)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if len(data) < 12 || binary.LittleEndian.Uint32(data) != signature1 || binary.LittleEndian.Uint32(data[4:]) != signature2 {
+        return nil, errors.New("not a KeePass database")
+    }
+
+    if major := binary.LittleEndian.Uint32(data[8:]) >> 16; major != 4 {
+        return nil, fmt.Errorf("unsupported KDBX version %d, only KDBX 4 is supported", major)
+    }
+
+    h, headerLength, err := readHeader(data)
+
+    if err != nil {
+        return nil, err
+    }
+
+    rest := data[headerLength:]
+
+    if len(rest) < 64 {
+        return nil, errors.New("truncated header")
+    }
+
+    headerHash := sha256.Sum256(data[:headerLength])
+
+    if !bytes.Equal(headerHash[:], rest[:32]) {
+        return nil, errors.New("corrupted header")
+    }
+
+    compositeKey, err := compositeKey(password, keyFile)
+
+    if err != nil {
+        return nil, err
+    }
+
+    transformed, err := transformKey(compositeKey, h.kdf)
+
+    if err != nil {
+        return nil, err
+    }
+
+    encryptionKey := sha256.Sum256(concat(h.masterSeed, transformed))
+    hmacKey := sha512.Sum512(concat(h.masterSeed, transformed, []byte{1}))
+
+    if !hmac.Equal(blockHMAC(hmacKey[:], ^uint64(0), data[:headerLength]), rest[32:64]) {
+        return nil, ErrCredentials
+    }
+
+    payload, err := readBlocks(rest[64:], hmacKey[:])
+
+    if err != nil {
+        return nil, err
+    }
+
+    payload, err = decrypt(h, encryptionKey[:], payload)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if h.compressed {
+        gz, err := gzip.NewReader(bytes.NewReader(payload))
+
+        if err != nil {
+            return nil, err
+        }
+
+        if payload, err = io.ReadAll(gz); err != nil {
+            return nil, err
+        }
+    }
+
+    return parseInner(payload)
+}
+
+// readHeader parses the outer header, returning its length.
+func readHeader(data []byte) (*header, int, error) {
+    h := &header{}
+    offset := 12
+
+    for {
+        if len(data) < offset+5 {
+            return nil, 0, errors.New("truncated header")
+        }
+
+        id := data[offset]
+        size := int(binary.LittleEndian.Uint32(data[offset+1:]))
+        offset += 5
+
+        if len(data) < offset+size {
+            return nil, 0, errors.New("truncated header")
+        }
+
+        value := data[offset : offset+size]
+        offset += size
+
+        switch id {
+        case headerEnd:
+            if h.cipherID == nil || h.masterSeed == nil || h.iv == nil || h.kdf == nil {
+                return nil, 0, errors.New("incomplete header")
+            }
+
+            return h, offset, nil
+        case headerCipherID:
+            h.cipherID = value
+        case headerCompression:
+            h.compressed = len(value) == 4 && binary.LittleEndian.Uint32(value) == 1
+        case headerMasterSeed:
+            h.masterSeed = value
+        case headerIV:
+            h.iv = value
+        case headerKdfParams:
+            kdf, err := readVariantDictionary(value)
+
+            if err != nil {
+                return nil, 0, err
+            }
+
+            h.kdf = kdf
+        }
+    }
+}
+
+// readVariantDictionary reads the raw values of a KeePass variant
+// dictionary, as used for the KDF parameters.
+func readVariantDictionary(data []byte) (map[string][]byte, error) {
+    if len(data) < 2 || data[1] != 1 {
+        return nil, errors.New("unsupported KDF parameters")
+    }
+
+    values := make(map[string][]byte)
+    data = data[2:]
+
+    for len(data) > 0 && data[0] != 0 {
+        if len(data) < 5 {
+            return nil, errors.New("truncated KDF parameters")
+        }
+
+        keyLength := int(binary.LittleEndian.Uint32(data[1:]))
+
+        if len(data) < 9+keyLength {
+            return nil, errors.New("truncated KDF parameters")
+        }
+
+        key := string(data[5 : 5+keyLength])
+        data = data[5+keyLength:]
+        valueLength := int(binary.LittleEndian.Uint32(data))
+
+        if len(data) < 4+valueLength {
+            return nil, errors.New("truncated KDF parameters")
+        }
+
+        values[key] = data[4 : 4+valueLength]
+        data = data[4+valueLength:]
+    }
+
+    return values, nil
+}
+
+// transformKey runs the composite key through the database's KDF.
+func transformKey(key []byte, params map[string][]byte) ([]byte, error) {
+    uint64Param := func(name string) uint64 {
+        switch v := params[name]; len(v) {
+        case 4:
+            return uint64(binary.LittleEndian.Uint32(v))
+        case 8:
+            return binary.LittleEndian.Uint64(v)
+        }
+
+        return 0
+    }
+
+    switch uuid := params["$UUID"]; {
+    case bytes.Equal(uuid, kdfAES):
+        block, err := aes.NewCipher(params["S"])
+
+        if err != nil {
+            return nil, err
+        }
+
+        transformed := bytes.Clone(key)
+
+        for range uint64Param("R") {
+            block.Encrypt(transformed[:16], transformed[:16])
+            block.Encrypt(transformed[16:], transformed[16:])
+        }
+
+        sum := sha256.Sum256(transformed)
+
+        return sum[:], nil
+    case bytes.Equal(uuid, kdfArgon2d), bytes.Equal(uuid, kdfArgon2id):
+        if uint64Param("V") != argon2Version {
+            return nil, fmt.Errorf("unsupported Argon2 version %#x", uint64Param("V"))
+        }
+
+        mode := argon2d
+
+        if bytes.Equal(uuid, kdfArgon2id) {
+            mode = argon2id
+        }
+
+        return argon2Key(mode, key, params["S"], params["K"], params["A"],
+            uint32(uint64Param("I")), uint32(uint64Param("M")/1024), uint8(uint64Param("P")), 32), nil
+    }
+
+    return nil, errors.New("unsupported key derivation function")
+}
+
+// readBlocks verifies and joins the HMAC protected blocks of the payload.
+func readBlocks(data, hmacKey []byte) ([]byte, error) {
+    var payload []byte
+
+    for index := uint64(0); ; index++ {
+        if len(data) < 36 {
+            return nil, errors.New("truncated data")
+        }
+
+        mac := data[:32]
+        size := int(binary.LittleEndian.Uint32(data[32:]))
+
+        if len(data) < 36+size {
+            return nil, errors.New("truncated data")
+        }
+
+        if !hmac.Equal(blockHMAC(hmacKey, index, data[32:36+size]), mac) {
+            return nil, errors.New("corrupted data")
+        }
+
+        if size == 0 {
+            return payload, nil
+        }
+
+        payload = append(payload, data[36:36+size]...)
+        data = data[36+size:]
+    }
+}
+
+// blockHMAC authenticates the block at index (the header is at index
+// 2^64-1), given the length-prefixed block.
+func blockHMAC(hmacKey []byte, index uint64, block []byte) []byte {
+    var indexBytes [8]byte
+    binary.LittleEndian.PutUint64(indexBytes[:], index)
+    key := sha512.Sum512(concat(indexBytes[:], hmacKey))
+
+    mac := hmac.New(sha256.New, key[:])
+    mac.Write(indexBytes[:])
+    mac.Write(block)
+
+    return mac.Sum(nil)
+}
+
+func decrypt(h *header, key, payload []byte) ([]byte, error) {
+    switch {
+    case bytes.Equal(h.cipherID, cipherAES256):
+        block, err := aes.NewCipher(key)
+
+        if err != nil {
+            return nil, err
+        }
+
+        if len(h.iv) != aes.BlockSize || len(payload) == 0 || len(payload)%aes.BlockSize != 0 {
+            return nil, errors.New("corrupted data")
+        }
+
+        plain := make([]byte, len(payload))
+        cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(plain, payload)
+        padding := int(plain[len(plain)-1])
+
+        if padding == 0 || padding > aes.BlockSize {
+            return nil, errors.New("corrupted data")
+        }
+
+        return plain[:len(plain)-padding], nil
+    case bytes.Equal(h.cipherID, cipherChaCha20):
+        stream, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+
+        if err != nil {
+            return nil, err
+        }
+
+        plain := make([]byte, len(payload))
+        stream.XORKeyStream(plain, payload)
+
+        return plain, nil
+    }
+
+    return nil, errors.New("unsupported cipher, only AES-256 and ChaCha20 are supported")
+}
+
+func concat(parts ...[]byte) []byte {
+    return bytes.Join(parts, nil)
+}
@@ -0,0 +1,276 @@
+package kdbx
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "flag"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+    "testing"
+)
+
+var update = flag.Bool("update", false, "write the testdata databases again")
+
+func TestMain(m *testing.M) {
+    flag.Parse()
+
+    if *update {
+        for _, f := range fixtures {
+            data, err := writeFixture(f)
+
+            if err == nil {
+                err = os.WriteFile(filepath.Join("testdata", f.File), data, 0644)
+            }
+
+            if err == nil && f.KeyFile != nil {
+                err = os.WriteFile(filepath.Join("testdata", strings.TrimSuffix(f.File, ".kdbx")+".keyx"), f.KeyFile, 0644)
+            }
+
+            if err != nil {
+                panic(err)
+            }
+        }
+    }
+
+    os.Exit(m.Run())
+}
+
+func readFixture(t *testing.T, f fixture) ([]byte, []byte) {
+    t.Helper()
+
+    data, err := os.ReadFile(filepath.Join("testdata", f.File))
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var keyFile []byte
+
+    if f.KeyFile != nil {
+        if keyFile, err = os.ReadFile(filepath.Join("testdata", strings.TrimSuffix(f.File, ".kdbx")+".keyx")); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    return data, keyFile
+}
+
+func TestOpen(t *testing.T) {
+    for _, f := range fixtures {
+        t.Run(f.File, func(t *testing.T) {
+            data, keyFile := readFixture(t, f)
+            db, err := Open(bytes.NewReader(data), f.Password, keyFile)
+
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            if db.RecycleBin != uuid(7) {
+                t.Errorf("RecycleBin = %q, want %q", db.RecycleBin, uuid(7))
+            }
+
+            compareGroup(t, "Root", db.Root, fixtureRoot)
+        })
+    }
+}
+
+// compareGroup compares a group read from a fixture with its description,
+// history left out.
+func compareGroup(t *testing.T, path string, got *Group, want fixtureGroup) {
+    t.Helper()
+
+    if got.UUID != want.UUID || got.Name != want.Name || got.Notes != want.Notes {
+        t.Errorf("%s: group %q %q %q, want %q %q %q", path, got.UUID, got.Name, got.Notes, want.UUID, want.Name, want.Notes)
+    }
+
+    if len(got.Entries) != len(want.Entries) || len(got.Groups) != len(want.Groups) {
+        t.Fatalf("%s: %d entries and %d groups, want %d and %d", path, len(got.Entries), len(got.Groups), len(want.Entries), len(want.Groups))
+    }
+
+    for i, entry := range want.Entries {
+        fields := make(map[string]string)
+
+        for _, field := range entry.Fields {
+            fields[field.Key] = field.Value
+        }
+
+        var tags []string
+
+        if entry.Tags != "" {
+            tags = strings.Split(entry.Tags, ";")
+        }
+
+        if got.Entries[i].UUID != entry.UUID {
+            t.Errorf("%s: entry %d UUID = %q, want %q", path, i, got.Entries[i].UUID, entry.UUID)
+        }
+
+        if !equalFields(got.Entries[i].Fields, fields) {
+            t.Errorf("%s: entry %d fields = %v, want %v", path, i, got.Entries[i].Fields, fields)
+        }
+
+        if !slices.Equal(got.Entries[i].Tags, tags) {
+            t.Errorf("%s: entry %d tags = %v, want %v", path, i, got.Entries[i].Tags, tags)
+        }
+    }
+
+    for i, group := range want.Groups {
+        compareGroup(t, path+" / "+group.Name, got.Groups[i], group)
+    }
+}
+
+func equalFields(a, b map[string]string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+
+    for key, value := range a {
+        if b[key] != value {
+            return false
+        }
+    }
+
+    return true
+}
+
+func TestOpenWrongCredentials(t *testing.T) {
+    for _, f := range fixtures {
+        t.Run(f.File, func(t *testing.T) {
+            data, keyFile := readFixture(t, f)
+
+            if _, err := Open(bytes.NewReader(data), "wrong", keyFile); !errors.Is(err, ErrCredentials) {
+                t.Errorf("wrong password: err = %v, want ErrCredentials", err)
+            }
+
+            if keyFile == nil {
+                return
+            }
+
+            if _, err := Open(bytes.NewReader(data), f.Password, nil); !errors.Is(err, ErrCredentials) {
+                t.Errorf("no key file: err = %v, want ErrCredentials", err)
+            }
+        })
+    }
+}
+
+// keepassxcPassword unlocks testdata/keepassxc.kdbx, which KeePassXC wrote
+// with testdata/keepassxc.sh.
+const keepassxcPassword = "correct horse battery staple"
+
+func TestOpenKeePassXC(t *testing.T) {
+    data, err := os.ReadFile(filepath.Join("testdata", "keepassxc.kdbx"))
+
+    if errors.Is(err, os.ErrNotExist) {
+        t.Skip("no testdata/keepassxc.kdbx, write it with testdata/keepassxc.sh")
+    }
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    db, err := Open(bytes.NewReader(data), keepassxcPassword, nil)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if db.Root.Name != "Root" {
+        t.Errorf("root group = %q, want Root", db.Root.Name)
+    }
+
+    prod := childGroup(t, db.Root, "Prod")
+    eu := childGroup(t, prod, "EU")
+
+    want := map[*Group]map[string]string{
+        prod: {"Title": "grafana", "UserName": "admin", "URL": "https://grafana.example.com"},
+        eu:   {"Title": "orders", "UserName": "app", "Password": `s3cret;"x"`, "URL": "postgres://orders.eu.example.com:5432/orders", "Notes": "Orders database"},
+    }
+
+    for group, fields := range want {
+        if len(group.Entries) != 1 {
+            t.Fatalf("%s: %d entries, want 1", group.Name, len(group.Entries))
+        }
+
+        for key, value := range fields {
+            if got := group.Entries[0].Fields[key]; got != value {
+                t.Errorf("%s: %s = %q, want %q", group.Name, key, got, value)
+            }
+        }
+    }
+}
+
+// childGroup returns the subgroup of parent with the given name.
+func childGroup(t *testing.T, parent *Group, name string) *Group {
+    t.Helper()
+
+    for _, group := range parent.Groups {
+        if group.Name == name {
+            return group
+        }
+    }
+
+    t.Fatalf("%s: no group %q", parent.Name, name)
+    return nil
+}
+
+func TestOpenInvalid(t *testing.T) {
+    data, _ := readFixture(t, fixtures[0])
+
+    tests := map[string][]byte{
+        "empty":     nil,
+        "not kdbx":  []byte("SQLite format 3\x00 and then some more"),
+        "truncated": data[:len(data)/2],
+    }
+
+    for name, data := range tests {
+        if _, err := Open(bytes.NewReader(data), fixtures[0].Password, nil); err == nil || errors.Is(err, ErrCredentials) {
+            t.Errorf("%s: err = %v, want a format error", name, err)
+        }
+    }
+
+    // A flipped bit of the encrypted data fails its block's HMAC
+    corrupted := bytes.Clone(data)
+    corrupted[len(corrupted)-100] ^= 1
+
+    if _, err := Open(bytes.NewReader(corrupted), fixtures[0].Password, nil); err == nil {
+        t.Error("corrupted: no error")
+    }
+}
+
+func TestKeyFileKey(t *testing.T) {
+    raw := []byte("0123456789abcdef0123456789abcdef")
+    hexKey := []byte(hex.EncodeToString(fixtureKey))
+    other := []byte("any file at all")
+    otherSum := sha256.Sum256(other)
+
+    tests := []struct {
+        name    string
+        data    []byte
+        want    []byte
+        wantErr bool
+    }{
+        {"xml 2.0", fixtureKeyFile, fixtureKey, false},
+        {"xml 2.0 wrong hash", bytes.Replace(fixtureKeyFile, []byte(`Hash="`), []byte(`Hash="0`), 1), nil, true},
+        {"xml 1.0", []byte("<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>" + base64.StdEncoding.EncodeToString(fixtureKey) + "</Data></Key></KeyFile>"), fixtureKey, false},
+        {"32 bytes", raw, raw, false},
+        {"64 hex digits", hexKey, fixtureKey, false},
+        {"other", other, otherSum[:], false},
+    }
+
+    for _, test := range tests {
+        got, err := keyFileKey(test.data)
+
+        if (err != nil) != test.wantErr {
+            t.Errorf("%s: err = %v", test.name, err)
+            continue
+        }
+
+        if !bytes.Equal(got, test.want) {
+            t.Errorf("%s: key = %x, want %x", test.name, got, test.want)
+        }
+    }
+}
@@ -0,0 +1,100 @@
+package kdbx
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/xml"
+    "errors"
+    "strings"
+)
+
+type xmlKeyFile struct {
+    Version string `xml:"Meta>Version"`
+    Data    struct {
+        Hash  string `xml:"Hash,attr"`
+        Value string `xml:",chardata"`
+    } `xml:"Key>Data"`
+}
+
+// compositeKey combines the password and key file into the key the KDF
+// transforms.
+func compositeKey(password string, keyFile []byte) ([]byte, error) {
+    var parts [][]byte
+
+    if password != "" {
+        sum := sha256.Sum256([]byte(password))
+        parts = append(parts, sum[:])
+    }
+
+    if keyFile != nil {
+        key, err := keyFileKey(keyFile)
+
+        if err != nil {
+            return nil, err
+        }
+
+        parts = append(parts, key)
+    }
+
+    if len(parts) == 0 {
+        return nil, errors.New("a password or key file is needed")
+    }
+
+    sum := sha256.Sum256(concat(parts...))
+
+    return sum[:], nil
+}
+
+// keyFileKey returns the key held by a key file: an XML key file (version
+// 1.0 or 2.0), 32 raw bytes or 64 hex digits. Any other file is hashed.
+func keyFileKey(data []byte) ([]byte, error) {
+    trimmed := bytes.TrimSpace(data)
+
+    if bytes.HasPrefix(trimmed, []byte("<")) {
+        keyFile := &xmlKeyFile{}
+
+        if err := xml.Unmarshal(trimmed, keyFile); err == nil && keyFile.Data.Value != "" {
+            return xmlKeyFileKey(keyFile)
+        }
+    }
+
+    if len(data) == 32 {
+        return data, nil
+    }
+
+    if len(data) == 64 {
+        if key, err := hex.DecodeString(string(data)); err == nil {
+            return key, nil
+        }
+    }
+
+    sum := sha256.Sum256(data)
+
+    return sum[:], nil
+}
+
+func xmlKeyFileKey(keyFile *xmlKeyFile) ([]byte, error) {
+    value := strings.Join(strings.Fields(keyFile.Data.Value), "")
+
+    if !strings.HasPrefix(keyFile.Version, "2.") {
+        return base64.StdEncoding.DecodeString(value)
+    }
+
+    key, err := hex.DecodeString(value)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if keyFile.Data.Hash != "" {
+        sum := sha256.Sum256(key)
+
+        if !strings.EqualFold(hex.EncodeToString(sum[:4]), keyFile.Data.Hash) {
+            return nil, errors.New("corrupted key file")
+        }
+    }
+
+    return key, nil
+}
@@ -0,0 +1,23 @@
+#!/bin/sh
+# Writes keepassxc.kdbx with keepassxc-cli, for TestOpenKeePassXC. It's
+# the only fixture not written by writer_test.go, so that the reader is
+# checked against a database from KeePassXC too.
+set -eu
+
+cd "$(dirname "$0")"
+
+password='correct horse battery staple'
+db=keepassxc.kdbx
+
+rm -f "$db"
+printf '%s\n%s\n' "$password" "$password" | keepassxc-cli db-create -q -p "$db"
+
+echo "$password" | keepassxc-cli mkdir -q "$db" Prod
+echo "$password" | keepassxc-cli mkdir -q "$db" Prod/EU
+
+printf '%s\n%s\n' "$password" 's3cret;"x"' | keepassxc-cli add -q -p \
+    -u app --url 'postgres://orders.eu.example.com:5432/orders' \
+    --notes 'Orders database' "$db" Prod/EU/orders
+
+echo "$password" | keepassxc-cli add -q \
+    -u admin --url 'https://grafana.example.com' "$db" Prod/grafana
@@ -0,0 +1,390 @@
+package kdbx
+
+import (
+    "bytes"
+    "compress/gzip"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "strings"
+
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/chacha20"
+)
+
+// This writes the KDBX 4 files in testdata, run with -update to write them
+// again. It's written from the format, apart from the reader: only its
+// Argon2d, checked against RFC 9106, is shared.
+
+// fixture describes a database written to testdata.
+type fixture struct {
+    File     string
+    Password string
+    KeyFile  []byte // contents of the key file
+    Key      []byte // key the key file holds
+    KDF      string // aes, argon2d or argon2id
+    Cipher   string // aes or chacha20
+    Compress bool
+}
+
+// fixtureValue is a string field of a fixture entry.
+type fixtureValue struct {
+    Key, Value string
+    Protected  bool
+}
+
+// fixtureEntry is an entry of a fixture, with previous versions.
+type fixtureEntry struct {
+    UUID    string
+    Tags    string
+    Fields  []fixtureValue
+    History []fixtureEntry
+}
+
+// fixtureGroup is a group of a fixture.
+type fixtureGroup struct {
+    UUID    string
+    Name    string
+    Notes   string
+    Entries []fixtureEntry
+    Groups  []fixtureGroup
+}
+
+func uuid(n byte) string {
+    return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{n}, 16))
+}
+
+// fixtureRoot is the content of every fixture: nested groups, protected
+// values before and after history entries, and a recycle bin.
+var fixtureRoot = fixtureGroup{
+    UUID: uuid(1),
+    Name: "Passwords",
+    Entries: []fixtureEntry{{
+        UUID: uuid(2),
+        Fields: []fixtureValue{
+            {"Title", "Mail", false},
+            {"Password", "not a database", true},
+        },
+    }},
+    Groups: []fixtureGroup{
+        {
+            UUID:  uuid(3),
+            Name:  "Databases",
+            Notes: "Team databases",
+            Groups: []fixtureGroup{{
+                UUID: uuid(4),
+                Name: "Production",
+                Entries: []fixtureEntry{{
+                    UUID: uuid(5),
+                    Tags: "postgres;prod",
+                    Fields: []fixtureValue{
+                        {"Title", "orders", false},
+                        {"UserName", "app", false},
+                        {"Password", "s3cret & <new>", true},
+                        {"URL", "postgres://orders.example.com:5433/orders", false},
+                        {"sslmode", "require", false},
+                    },
+                    History: []fixtureEntry{{
+                        UUID: uuid(5),
+                        Fields: []fixtureValue{
+                            {"Title", "orders", false},
+                            {"Password", "old password", true},
+                        },
+                    }},
+                }},
+            }},
+            Entries: []fixtureEntry{{
+                UUID: uuid(6),
+                Fields: []fixtureValue{
+                    {"Title", "staging", false},
+                    {"Password", "staging password", true},
+                    {"API key", "protected custom field", true},
+                },
+            }},
+        },
+        {
+            UUID: uuid(7),
+            Name: "Recycle Bin",
+            Entries: []fixtureEntry{{
+                UUID:   uuid(8),
+                Fields: []fixtureValue{{"Title", "deleted", false}},
+            }},
+        },
+    },
+}
+
+var fixtureKey = []byte{
+    0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+    0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+}
+
+// fixtureKeyFile is an XML key file of version 2.0 holding fixtureKey.
+var fixtureKeyFile = xmlKeyFileV2(fixtureKey)
+
+func xmlKeyFileV2(key []byte) []byte {
+    sum := sha256.Sum256(key)
+    data := strings.ToUpper(hex.EncodeToString(key))
+
+    return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+    <Meta>
+        <Version>2.0</Version>
+    </Meta>
+    <Key>
+        <Data Hash="%X">
+            %s %s
+            %s %s
+        </Data>
+    </Key>
+</KeyFile>
+`, sum[:4], data[:16], data[16:32], data[32:48], data[48:]))
+}
+
+var fixtures = []fixture{
+    {File: "aes-kdf.kdbx", Password: "correct horse", KDF: "aes", Cipher: "aes", Compress: true},
+    {File: "argon2d.kdbx", Password: "correct horse", KDF: "argon2d", Cipher: "chacha20"},
+    {File: "argon2id-keyfile.kdbx", Password: "correct horse", KeyFile: fixtureKeyFile, Key: fixtureKey, KDF: "argon2id", Cipher: "aes", Compress: true},
+}
+
+// writeFixture returns the database file of a fixture.
+func writeFixture(f fixture) ([]byte, error) {
+    random := func(n int) []byte {
+        b := make([]byte, n)
+        rand.Read(b)
+        return b
+    }
+
+    le32 := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+    le64 := func(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+
+    // Composite key
+    composite := sha256.New()
+
+    if f.Password != "" {
+        sum := sha256.Sum256([]byte(f.Password))
+        composite.Write(sum[:])
+    }
+
+    if f.Key != nil {
+        composite.Write(f.Key)
+    }
+
+    key := composite.Sum(nil)
+
+    // Key derivation, with its parameters as a variant dictionary
+    salt := random(32)
+    var transformed []byte
+    kdf := []byte{0x00, 0x01}
+
+    addParam := func(kind byte, name string, value []byte) {
+        kdf = append(kdf, kind)
+        kdf = append(kdf, le32(uint32(len(name)))...)
+        kdf = append(kdf, name...)
+        kdf = append(kdf, le32(uint32(len(value)))...)
+        kdf = append(kdf, value...)
+    }
+
+    switch f.KDF {
+    case "aes":
+        const rounds = 1000
+        addParam(0x42, "$UUID", kdfAES)
+        addParam(0x05, "R", le64(rounds))
+        addParam(0x42, "S", salt)
+
+        block, _ := aes.NewCipher(salt)
+        transformed = bytes.Clone(key)
+
+        for range rounds {
+            block.Encrypt(transformed[:16], transformed[:16])
+            block.Encrypt(transformed[16:], transformed[16:])
+        }
+
+        sum := sha256.Sum256(transformed)
+        transformed = sum[:]
+    case "argon2d", "argon2id":
+        const iterations, memory, parallelism = 2, 1024 * 1024, 2
+
+        if f.KDF == "argon2d" {
+            addParam(0x42, "$UUID", kdfArgon2d)
+            transformed = argon2Key(argon2d, key, salt, nil, nil, iterations, memory/1024, parallelism, 32)
+        } else {
+            addParam(0x42, "$UUID", kdfArgon2id)
+            transformed = argon2.IDKey(key, salt, iterations, memory/1024, parallelism, 32)
+        }
+
+        addParam(0x42, "S", salt)
+        addParam(0x04, "P", le32(parallelism))
+        addParam(0x05, "M", le64(memory))
+        addParam(0x05, "I", le64(iterations))
+        addParam(0x04, "V", le32(0x13))
+    }
+
+    kdf = append(kdf, 0)
+
+    // Outer header
+    masterSeed := random(32)
+    var cipherID, iv []byte
+
+    if f.Cipher == "aes" {
+        cipherID, iv = cipherAES256, random(16)
+    } else {
+        cipherID, iv = cipherChaCha20, random(12)
+    }
+
+    compression := uint32(0)
+
+    if f.Compress {
+        compression = 1
+    }
+
+    header := append(le32(signature1), le32(signature2)...)
+    header = append(header, le32(4<<16)...)
+
+    addField := func(id byte, value []byte) {
+        header = append(header, id)
+        header = append(header, le32(uint32(len(value)))...)
+        header = append(header, value...)
+    }
+
+    addField(2, cipherID)
+    addField(3, le32(compression))
+    addField(4, masterSeed)
+    addField(7, iv)
+    addField(11, kdf)
+    addField(0, []byte("\r\n\r\n"))
+
+    // Inner header and document, protected values XORed with the inner
+    // ChaCha20 stream in document order
+    streamKey := random(64)
+    streamHash := sha512.Sum512(streamKey)
+    stream, _ := chacha20.NewUnauthenticatedCipher(streamHash[:32], streamHash[32:44])
+
+    inner := []byte{1}
+    inner = append(inner, le32(4)...)
+    inner = append(inner, le32(3)...)
+    inner = append(inner, 2)
+    inner = append(inner, le32(uint32(len(streamKey)))...)
+    inner = append(inner, streamKey...)
+    inner = append(inner, 0)
+    inner = append(inner, le32(0)...)
+    inner = append(inner, fixtureDocument(stream)...)
+
+    if f.Compress {
+        var compressed bytes.Buffer
+        gz := gzip.NewWriter(&compressed)
+        gz.Write(inner)
+        gz.Close()
+        inner = compressed.Bytes()
+    }
+
+    encryptionKey := sha256.Sum256(append(bytes.Clone(masterSeed), transformed...))
+    var encrypted []byte
+
+    if f.Cipher == "aes" {
+        padding := aes.BlockSize - len(inner)%aes.BlockSize
+        inner = append(inner, bytes.Repeat([]byte{byte(padding)}, padding)...)
+        block, _ := aes.NewCipher(encryptionKey[:])
+        encrypted = make([]byte, len(inner))
+        cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, inner)
+    } else {
+        c, _ := chacha20.NewUnauthenticatedCipher(encryptionKey[:], iv)
+        encrypted = make([]byte, len(inner))
+        c.XORKeyStream(encrypted, inner)
+    }
+
+    // Header hash and HMAC, then the HMAC protected blocks
+    hmacBase := sha512.Sum512(append(append(bytes.Clone(masterSeed), transformed...), 1))
+
+    mac := func(index uint64, data []byte) []byte {
+        blockKey := sha512.Sum512(append(le64(index), hmacBase[:]...))
+        h := hmac.New(sha256.New, blockKey[:])
+        h.Write(le64(index))
+        h.Write(data)
+        return h.Sum(nil)
+    }
+
+    headerHash := sha256.Sum256(header)
+    file := append(bytes.Clone(header), headerHash[:]...)
+    file = append(file, mac(^uint64(0), header)...)
+
+    blocks := [][]byte{encrypted[:len(encrypted)/2], encrypted[len(encrypted)/2:], nil}
+
+    for i, block := range blocks {
+        data := append(le32(uint32(len(block))), block...)
+        file = append(file, mac(uint64(i), data)...)
+        file = append(file, data...)
+    }
+
+    return file, nil
+}
+
+// fixtureDocument returns the XML document of fixtureRoot.
+func fixtureDocument(stream *chacha20.Cipher) []byte {
+    var doc strings.Builder
+
+    doc.WriteString(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\n")
+    doc.WriteString("<KeePassFile>\n<Meta>\n<Generator>kdbx tests</Generator>\n<DatabaseName>Fixture</DatabaseName>\n")
+    doc.WriteString("<RecycleBinEnabled>True</RecycleBinEnabled>\n<RecycleBinUUID>" + uuid(7) + "</RecycleBinUUID>\n</Meta>\n<Root>\n")
+    writeFixtureGroup(&doc, fixtureRoot, stream)
+    doc.WriteString("<DeletedObjects/>\n</Root>\n</KeePassFile>\n")
+
+    return []byte(doc.String())
+}
+
+func writeFixtureGroup(doc *strings.Builder, group fixtureGroup, stream *chacha20.Cipher) {
+    fmt.Fprintf(doc, "<Group>\n<UUID>%s</UUID>\n<Name>%s</Name>\n<Notes>%s</Notes>\n<IconID>48</IconID>\n", group.UUID, escape(group.Name), escape(group.Notes))
+
+    for _, entry := range group.Entries {
+        writeFixtureEntry(doc, entry, stream)
+    }
+
+    for _, child := range group.Groups {
+        writeFixtureGroup(doc, child, stream)
+    }
+
+    doc.WriteString("</Group>\n")
+}
+
+func writeFixtureEntry(doc *strings.Builder, entry fixtureEntry, stream *chacha20.Cipher) {
+    fmt.Fprintf(doc, "<Entry>\n<UUID>%s</UUID>\n<IconID>0</IconID>\n<Tags>%s</Tags>\n", entry.UUID, escape(entry.Tags))
+    doc.WriteString("<Times><LastModificationTime>2Kx+2g4AAAA=</LastModificationTime></Times>\n")
+
+    for _, field := range entry.Fields {
+        value := escape(field.Value)
+        attr := ""
+
+        if field.Protected {
+            data := []byte(field.Value)
+            stream.XORKeyStream(data, data)
+            value = base64.StdEncoding.EncodeToString(data)
+            attr = ` Protected="True"`
+        }
+
+        fmt.Fprintf(doc, "<String>\n<Key>%s</Key>\n<Value%s>%s</Value>\n</String>\n", escape(field.Key), attr, value)
+    }
+
+    doc.WriteString("<AutoType><Enabled>True</Enabled></AutoType>\n")
+
+    if len(entry.History) > 0 {
+        doc.WriteString("<History>\n")
+
+        for _, old := range entry.History {
+            writeFixtureEntry(doc, old, stream)
+        }
+
+        doc.WriteString("</History>\n")
+    }
+
+    doc.WriteString("</Entry>\n")
+}
+
+func escape(s string) string {
+    return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
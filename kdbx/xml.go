@@ -0,0 +1,325 @@
+package kdbx
+
+import (
+    "bytes"
+    "crypto/sha512"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+
+    "golang.org/x/crypto/chacha20"
+)
+
+// Inner header fields.
+const (
+    innerHeaderEnd       = 0
+    innerHeaderStreamID  = 1
+    innerHeaderStreamKey = 2
+)
+
+const innerStreamChaCha20 = 3
+
+// parser reads the XML document, unprotecting protected values with the
+// inner random stream. The stream is shared by all protected values in
+// document order, so every one of them has to be read, even those of
+// history entries that aren't kept.
+type parser struct {
+    decoder *xml.Decoder
+    stream  *chacha20.Cipher
+}
+
+// parseInner parses the decrypted payload: the inner header, then the XML
+// document.
+func parseInner(data []byte) (*Database, error) {
+    var streamID uint32
+    var streamKey []byte
+
+    for done := false; !done; {
+        if len(data) < 5 {
+            return nil, errors.New("truncated inner header")
+        }
+
+        id := data[0]
+        size := int(binary.LittleEndian.Uint32(data[1:]))
+
+        if len(data) < 5+size {
+            return nil, errors.New("truncated inner header")
+        }
+
+        value := data[5 : 5+size]
+        data = data[5+size:]
+
+        switch id {
+        case innerHeaderEnd:
+            done = true
+        case innerHeaderStreamID:
+            if size == 4 {
+                streamID = binary.LittleEndian.Uint32(value)
+            }
+        case innerHeaderStreamKey:
+            streamKey = value
+        }
+    }
+
+    if streamID != innerStreamChaCha20 {
+        return nil, fmt.Errorf("unsupported inner stream %d", streamID)
+    }
+
+    key := sha512.Sum512(streamKey)
+    stream, err := chacha20.NewUnauthenticatedCipher(key[:32], key[32:44])
+
+    if err != nil {
+        return nil, err
+    }
+
+    p := &parser{decoder: xml.NewDecoder(bytes.NewReader(data)), stream: stream}
+
+    return p.document()
+}
+
+func (p *parser) document() (*Database, error) {
+    db := &Database{}
+    recycleBinEnabled := true
+
+    for {
+        token, err := p.decoder.Token()
+
+        if err == io.EOF {
+            break
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        start, ok := token.(xml.StartElement)
+
+        if !ok {
+            continue
+        }
+
+        switch start.Name.Local {
+        case "KeePassFile", "Meta", "Root":
+            // descend
+        case "RecycleBinEnabled":
+            value, err := p.text()
+
+            if err != nil {
+                return nil, err
+            }
+
+            recycleBinEnabled = value != "False"
+        case "RecycleBinUUID":
+            if db.RecycleBin, err = p.text(); err != nil {
+                return nil, err
+            }
+        case "Group":
+            if db.Root, err = p.group(); err != nil {
+                return nil, err
+            }
+        default:
+            if err := p.decoder.Skip(); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    if db.Root == nil {
+        return nil, errors.New("database without a root group")
+    }
+
+    if !recycleBinEnabled || db.RecycleBin == "AAAAAAAAAAAAAAAAAAAAAA==" {
+        db.RecycleBin = ""
+    }
+
+    return db, nil
+}
+
+func (p *parser) group() (*Group, error) {
+    group := &Group{}
+
+    for {
+        token, err := p.decoder.Token()
+
+        if err != nil {
+            return nil, err
+        }
+
+        switch t := token.(type) {
+        case xml.EndElement:
+            return group, nil
+        case xml.StartElement:
+            switch t.Name.Local {
+            case "UUID":
+                group.UUID, err = p.text()
+            case "Name":
+                group.Name, err = p.text()
+            case "Notes":
+                group.Notes, err = p.text()
+            case "Entry":
+                var entry *Entry
+
+                if entry, err = p.entry(); err == nil {
+                    group.Entries = append(group.Entries, entry)
+                }
+            case "Group":
+                var child *Group
+
+                if child, err = p.group(); err == nil {
+                    group.Groups = append(group.Groups, child)
+                }
+            default:
+                err = p.decoder.Skip()
+            }
+
+            if err != nil {
+                return nil, err
+            }
+        }
+    }
+}
+
+func (p *parser) entry() (*Entry, error) {
+    entry := &Entry{Fields: make(map[string]string)}
+
+    for {
+        token, err := p.decoder.Token()
+
+        if err != nil {
+            return nil, err
+        }
+
+        switch t := token.(type) {
+        case xml.EndElement:
+            return entry, nil
+        case xml.StartElement:
+            switch t.Name.Local {
+            case "UUID":
+                entry.UUID, err = p.text()
+            case "Tags":
+                var tags string
+
+                if tags, err = p.text(); err == nil {
+                    entry.Tags = strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' })
+                }
+            case "String":
+                err = p.field(entry)
+            case "History":
+                err = p.history()
+            default:
+                err = p.decoder.Skip()
+            }
+
+            if err != nil {
+                return nil, err
+            }
+        }
+    }
+}
+
+// history reads and drops the previous versions of an entry.
+func (p *parser) history() error {
+    for {
+        token, err := p.decoder.Token()
+
+        if err != nil {
+            return err
+        }
+
+        switch t := token.(type) {
+        case xml.EndElement:
+            return nil
+        case xml.StartElement:
+            if t.Name.Local == "Entry" {
+                _, err = p.entry()
+            } else {
+                err = p.decoder.Skip()
+            }
+
+            if err != nil {
+                return err
+            }
+        }
+    }
+}
+
+func (p *parser) field(entry *Entry) error {
+    var key, value string
+
+    for {
+        token, err := p.decoder.Token()
+
+        if err != nil {
+            return err
+        }
+
+        switch t := token.(type) {
+        case xml.EndElement:
+            entry.Fields[key] = value
+            return nil
+        case xml.StartElement:
+            switch t.Name.Local {
+            case "Key":
+                key, err = p.text()
+            case "Value":
+                protected := false
+
+                for _, attr := range t.Attr {
+                    if attr.Name.Local == "Protected" && attr.Value == "True" {
+                        protected = true
+                    }
+                }
+
+                if value, err = p.text(); err == nil && protected {
+                    value, err = p.unprotect(value)
+                }
+            default:
+                err = p.decoder.Skip()
+            }
+
+            if err != nil {
+                return err
+            }
+        }
+    }
+}
+
+func (p *parser) unprotect(value string) (string, error) {
+    data, err := base64.StdEncoding.DecodeString(value)
+
+    if err != nil {
+        return "", err
+    }
+
+    p.stream.XORKeyStream(data, data)
+
+    return string(data), nil
+}
+
+// text reads the text of the current element, up to its end.
+func (p *parser) text() (string, error) {
+    var text strings.Builder
+
+    for {
+        token, err := p.decoder.Token()
+
+        if err != nil {
+            return "", err
+        }
+
+        switch t := token.(type) {
+        case xml.CharData:
+            text.Write(t)
+        case xml.EndElement:
+            return text.String(), nil
+        case xml.StartElement:
+            if err := p.decoder.Skip(); err != nil {
+                return "", err
+            }
+        }
+    }
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "maps"
+    "os"
+    "slices"
+    "strings"
+
+    "tableplus-connections/kdbx"
+    "tableplus-connections/ui"
+)
+
+// keepassStandardFields are the fields every KeePass entry has, the others
+// being custom fields.
+var keepassStandardFields = []string{"Title", "UserName", "Password", "URL", "Notes"}
+
+// loadKeePass reads the connections of a KeePass (KDBX 4) database, opened
+// with the source password, key file or both. Entries are connections when
+// their URL is a database URL or their custom fields set a host, port,
+// driver or database, in which case a URL without a database scheme is the
+// host. Custom fields like User or Environment alone don't count. Every
+// group below the root is a group, with the group above it as its parent.
+// The picker and exports don't nest groups, so they're named by their path
+// like "Prod / EU". The recycle bin is left out.
+func loadKeePass(opts ExportOptions) (*SourceResult, error) {
+    if opts.SourcePath == "" {
+        return nil, errors.New("The KeePass source needs the database file as --source-path")
+    }
+
+    if opts.SourcePassword == "" && opts.SourceKeyFile == "" {
+        return nil, errors.New("The KeePass source needs --source-password, --source-key-file or both")
+    }
+
+    var keyFile []byte
+
+    if opts.SourceKeyFile != "" {
+        var err error
+        keyFile, err = os.ReadFile(opts.SourceKeyFile)
+
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    file, err := os.Open(opts.SourcePath)
+
+    if err != nil {
+        return nil, err
+    }
+
+    defer file.Close()
+
+    db, err := kdbx.Open(file, opts.SourcePassword, keyFile)
+
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", opts.SourcePath, err)
+    }
+
+    result := &SourceResult{}
+    used := make(map[string]bool)
+    var groups []*ui.Group
+
+    var walk func(group *kdbx.Group, parent *ui.Group)
+    walk = func(group *kdbx.Group, parent *ui.Group) {
+        if db.RecycleBin != "" && group.UUID == db.RecycleBin {
+            return
+        }
+
+        // Entries of the root group are ungrouped
+        var current *ui.Group
+
+        if group != db.Root {
+            current = &ui.Group{
+                ID:          "keepass:" + group.UUID,
+                Name:        group.Name,
+                Description: group.Notes,
+            }
+
+            if parent != nil {
+                current.Name = parent.Name + " / " + group.Name
+                current.ParentID = parent.ID
+            }
+
+            groups = append(groups, current)
+        }
+
+        for _, entry := range group.Entries {
+            connection, ok := keepassConnection(entry)
+
+            if !ok {
+                continue
+            }
+
+            if current != nil {
+                connection.GroupID = current.ID
+            }
+
+            if missing := completeConnection(connection); len(missing) > 0 {
+                result.Skipped = append(result.Skipped, SkippedItem{
+                    ID:      connection.ID,
+                    GroupID: connection.GroupID,
+                    Name:    connection.Name,
+                    Reason:  "missing or invalid " + strings.Join(missing, ", "),
+                })
+                continue
+            }
+
+            used[connection.GroupID] = true
+            result.Connections = append(result.Connections, connection)
+        }
+
+        for _, child := range group.Groups {
+            walk(child, current)
+        }
+    }
+
+    walk(db.Root, nil)
+
+    // Keep the groups holding connections, and the groups above them
+    for i := len(groups) - 1; i >= 0; i-- {
+        if used[groups[i].ID] && groups[i].ParentID != "" {
+            used[groups[i].ParentID] = true
+        }
+    }
+
+    for _, group := range groups {
+        if used[group.ID] {
+            result.Groups = append(result.Groups, group)
+        }
+    }
+
+    return result, nil
+}
+
+// keepassConnection maps an entry to a connection, reporting false for
+// entries that don't describe a database.
+func keepassConnection(entry *kdbx.Entry) (*AvailableConnection, bool) {
+    connection := &AvailableConnection{
+        ID:   "keepass:" + entry.UUID,
+        Name: entry.Fields["Title"],
+        Tags: entry.Tags,
+    }
+    parseConnectionURL(entry.Fields["URL"], connection)
+
+    for _, key := range slices.Sorted(maps.Keys(entry.Fields)) {
+        value := entry.Fields[key]
+
+        if slices.Contains(keepassStandardFields, key) || value == "" {
+            continue
+        }
+
+        setConnectionField(connection, key, value)
+    }
+
+    if !describesDatabase(connection) {
+        return nil, false
+    }
+
+    if connection.Address == "" {
+        connection.Address, connection.Port = splitHostPort(entry.Fields["URL"], connection.Port)
+    }
+
+    if username := entry.Fields["UserName"]; username != "" {
+        connection.Username = username
+    }
+
+    if password := entry.Fields["Password"]; password != "" {
+        connection.Password = password
+    }
+
+    return connection, true
+}
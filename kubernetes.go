@@ -0,0 +1,222 @@
+package main
+
+import (
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "maps"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "tableplus-connections/ui"
+)
+
+// kubernetesObject is the part of a Secret, or of a List of them as kubectl
+// prints several, that connections are read from.
+type kubernetesObject struct {
+    Kind     string `yaml:"kind"`
+    Metadata struct {
+        Name      string `yaml:"name"`
+        Namespace string `yaml:"namespace"`
+    } `yaml:"metadata"`
+    Data       map[string]string  `yaml:"data"`
+    StringData map[string]string  `yaml:"stringData"`
+    Items      []kubernetesObject `yaml:"items"`
+}
+
+// loadKubernetes reads database connections from Kubernetes Secrets: the
+// manifests in --source-path, a file or a directory, or the output of
+// kubectl get secret -o yaml on stdin. Secret keys are mapped by their
+// usual names, like host, port, username, password, database or uri. Every
+// namespace is a group.
+func loadKubernetes(opts ExportOptions) (*SourceResult, error) {
+    result := &SourceResult{}
+    var secrets []kubernetesObject
+
+    switch path := opts.SourcePath; path {
+    case "", "-":
+        if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+            return nil, errors.New("No Secrets to read: pipe kubectl get secret -o yaml, or set --source-path")
+        }
+
+        data, err := io.ReadAll(os.Stdin)
+
+        if err != nil {
+            return nil, err
+        }
+
+        if secrets, err = parseKubernetesSecrets(data); err != nil {
+            return nil, fmt.Errorf("stdin: %w", err)
+        }
+    default:
+        err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+            if err != nil {
+                return err
+            }
+
+            if d.IsDir() {
+                if file != path && strings.HasPrefix(d.Name(), ".") {
+                    return filepath.SkipDir
+                }
+
+                return nil
+            }
+
+            // Only manifests, when reading a directory
+            if file != path && !slices.Contains([]string{".yaml", ".yml", ".json"}, filepath.Ext(file)) {
+                return nil
+            }
+
+            data, err := os.ReadFile(file)
+
+            if err != nil {
+                return err
+            }
+
+            found, err := parseKubernetesSecrets(data)
+
+            if err != nil {
+                // Directories of manifests hold templates too
+                if file != path {
+                    result.Skipped = append(result.Skipped, SkippedItem{
+                        ID:     "k8s-file:" + file,
+                        Name:   file,
+                        Reason: err.Error(),
+                    })
+                    return nil
+                }
+
+                return err
+            }
+
+            secrets = append(secrets, found...)
+            return nil
+        })
+
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    groups := make(map[string]*ui.Group)
+
+    for _, secret := range secrets {
+        connection, err := kubernetesConnection(secret)
+        namespace := secret.Metadata.Namespace
+
+        if err == nil && connection == nil {
+            continue
+        }
+
+        if groups[namespace] == nil {
+            groups[namespace] = &ui.Group{ID: "k8s:" + namespace, Name: namespace}
+        }
+
+        if err != nil {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:      "k8s:" + namespace + "/" + secret.Metadata.Name,
+                GroupID: groups[namespace].ID,
+                Name:    secret.Metadata.Name,
+                Reason:  err.Error(),
+            })
+            continue
+        }
+
+        addFileConnection(result, connection)
+    }
+
+    for _, namespace := range slices.Sorted(maps.Keys(groups)) {
+        result.Groups = append(result.Groups, groups[namespace])
+    }
+
+    return result, nil
+}
+
+// parseKubernetesSecrets returns the Secrets of a multi document manifest,
+// including the items of Lists.
+func parseKubernetesSecrets(data []byte) ([]kubernetesObject, error) {
+    var secrets []kubernetesObject
+    decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+
+    for {
+        var object kubernetesObject
+
+        if err := decoder.Decode(&object); err == io.EOF {
+            break
+        } else if err != nil {
+            return nil, err
+        }
+
+        objects := append([]kubernetesObject{object}, object.Items...)
+
+        for _, object := range objects {
+            if object.Kind != "Secret" {
+                continue
+            }
+
+            if object.Metadata.Namespace == "" {
+                object.Metadata.Namespace = "default"
+            }
+
+            secrets = append(secrets, object)
+        }
+    }
+
+    return secrets, nil
+}
+
+// kubernetesConnection returns the connection a Secret describes, or nil
+// when it doesn't describe one, like TLS or registry Secrets.
+func kubernetesConnection(secret kubernetesObject) (*AvailableConnection, error) {
+    values := make(map[string]string)
+
+    for key, encoded := range secret.Data {
+        value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+
+        if err != nil {
+            return nil, fmt.Errorf("key %s: %w", key, err)
+        }
+
+        values[key] = string(value)
+    }
+
+    // stringData is merged into data by the API server, winning over it
+    maps.Copy(values, secret.StringData)
+
+    namespace := secret.Metadata.Namespace
+    connection := &AvailableConnection{
+        ID:      "k8s:" + namespace + "/" + secret.Metadata.Name,
+        GroupID: "k8s:" + namespace,
+        Name:    secret.Metadata.Name,
+    }
+
+    // Connection strings first, so that single fields override theirs
+    keys := slices.SortedFunc(maps.Keys(values), func(a, b string) int {
+        if isConnectionStringKey(a) != isConnectionStringKey(b) {
+            if isConnectionStringKey(a) {
+                return -1
+            }
+
+            return 1
+        }
+
+        return strings.Compare(a, b)
+    })
+
+    for _, key := range keys {
+        setPrefixedField(connection, key, values[key])
+    }
+
+    // A lone type or database key doesn't make a Secret a database's
+    if !describesDatabase(connection) || connection.Address == "" && connection.Password == "" {
+        return nil, nil
+    }
+
+    return connection, nil
+}
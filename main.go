@@ -2,233 +2,638 @@ package main
 
 import (
     "context"
-    "encoding/json"
     "errors"
-    "flag"
     "fmt"
-    "maps"
     "os"
     "os/exec"
     "runtime"
     "slices"
     "strconv"
     "strings"
+    "time"
 
     "github.com/1password/onepassword-sdk-go"
-    "github.com/RNCryptor/RNCryptor-go"
 
     "tableplus-connections/ui"
 )
 
 func main() {
-    var all bool
-    var groupByVault bool
-    var outputFile string
-    var password string
-    var open bool
-    const allUsage = "Export all connections, without interactive input"
-    const groupByVaultUsage = "Create a group for each vault of the exported items"
-    const outputUsage = "Output filename"
-    const passwordUsage = "Export password"
-    const openUsage = "Open the export immediately"
+    err := runCommand(os.Args[1:])
 
-    flag.BoolVar(&all, "all", false, allUsage)
-    flag.BoolVar(&all, "a", false, allUsage + " (shorthand)")
+    if errors.Is(err, ui.ErrAborted) {
+        fmt.Println(err.Error())
+        os.Exit(1)
+    }
+
+    if errors.Is(err, errDifferences) {
+        os.Exit(1)
+    }
 
-    flag.BoolVar(&groupByVault, "group-by-vault", false, groupByVaultUsage)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+        os.Exit(1)
+    }
+}
 
-    flag.StringVar(&outputFile, "output", "export", outputUsage)
-    flag.StringVar(&outputFile, "o", "export", outputUsage + " (shorthand)")
+// Values accepted by --auth.
+const (
+    AuthAuto           = "auto"
+    AuthDesktop        = "desktop"
+    AuthServiceAccount = "service-account"
+)
 
-    flag.StringVar(&password, "password", "password", passwordUsage)
-    flag.StringVar(&password, "p", "password", passwordUsage + " (shorthand)")
+var authNames = []string{AuthAuto, AuthDesktop, AuthServiceAccount}
 
-    flag.BoolVar(&open, "open", false, openUsage)
-    flag.Parse()
+// serviceAccountTokenEnv holds the token for service account authentication.
+const serviceAccountTokenEnv = "OP_SERVICE_ACCOUNT_TOKEN"
 
-    items, vaults, err := getDatabaseItems()
+// resolveAuth returns the authentication method to use. Auto picks the
+// service account when its token is set, and the desktop app otherwise.
+func resolveAuth(auth string) (string, error) {
+    switch auth {
+    case AuthDesktop, AuthServiceAccount:
+        return auth, nil
+    case AuthAuto, "":
+        if os.Getenv(serviceAccountTokenEnv) != "" {
+            return AuthServiceAccount, nil
+        }
 
-    if (err != nil) {
-        panic(err);
+        return AuthDesktop, nil
     }
 
-    connections, groups, err := parseAvailableConnections(items, vaults)
+    return "", fmt.Errorf("Unknown authentication method %q, expected one of %s", auth, strings.Join(authNames, ", "))
+}
+
+// newOnePasswordClient authenticates with 1Password, either through the
+// desktop app of the named account or with a service account token.
+func newOnePasswordClient(auth, accountName string) (*onepassword.Client, error) {
+    auth, err := resolveAuth(auth)
 
-    if (err != nil) {
-        panic(err);
+    if err != nil {
+        return nil, err
     }
 
-    var exportable []*AvailableConnection
+    var authOption onepassword.ClientOption
+
+    if auth == AuthServiceAccount {
+        token := os.Getenv(serviceAccountTokenEnv)
 
-    if all {
-        exportable = connections
+        if token == "" {
+            return nil, fmt.Errorf("%s is required for service account authentication", serviceAccountTokenEnv)
+        }
+
+        authOption = onepassword.WithServiceAccountToken(token)
     } else {
-        var selectable []ui.Item
-
-        for _, connection := range connections {
-            selectable = append(selectable, ui.Item{
-                ID: connection.ID,
-                TitleText: connection.Name,
-                DescriptionText: connection.Address,
-                GroupID: connection.GroupID,
-                Selected: true,
-            })
+        if (accountName == "") {
+            return nil, errors.New("Account name is required as the first argument")
         }
 
-        selected, err := ui.Run(selectable, groups)
+        authOption = onepassword.WithDesktopAppIntegration(accountName)
+    }
+
+    return onepassword.NewClient(
+        context.Background(),
+        authOption,
+        onepassword.WithIntegrationInfo("TablePlus connections", "v0.1.0"),
+    )
+}
+
+// onePasswordVault is a vault of one of the accounts being read.
+type onePasswordVault struct {
+    Account string
+    Client  *onepassword.Client
+    Vault   onepassword.VaultOverview
+}
+
+// loadOnePassword reads the connections of every account. With more than one
+// account, group names are prefixed with the account name, and a vault shared
+// by several accounts is only read once. Only the vaults in opts.Vaults are
+// read, if set, and with opts.PickVaults the user picks from those first.
+func loadOnePassword(opts ExportOptions) (*SourceResult, error) {
+    auth, err := resolveAuth(opts.Auth)
+
+    if err != nil {
+        return nil, err
+    }
+
+    accounts := opts.Accounts
+
+    // A service account token belongs to a single account, and without a
+    // name newOnePasswordClient reports it's missing
+    if auth == AuthServiceAccount || len(accounts) == 0 {
+        accounts = []string{""}
+    }
+
+    categories, err := parseCategories(opts.Categories)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var cache *MetadataCache
+
+    if opts.Cache && !opts.RefreshCache {
+        cache, err = loadMetadataCache(opts)
 
         if err != nil {
-            if errors.Is(err, ui.ErrAborted) {
-                fmt.Println(err.Error())
-                os.Exit(1)
-            }
+            fmt.Fprintf(os.Stderr, "Ignoring metadata cache: %s\n", err)
+            cache = nil
+        }
+    }
+
+    // A cache written for other categories holds other items
+    if cache != nil && !slices.Equal(cache.Categories, normalizeCategories(opts.Categories)) {
+        cache = nil
+    }
+
+    if cache != nil && time.Since(cache.CreatedAt) >= opts.CacheMaxAge {
+        cache = nil
+    }
+
+    vaults, err := listOnePasswordVaults(auth, accounts, opts.Vaults)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if opts.PickVaults {
+        vaults, err = pickVaults(vaults, len(accounts) > 1)
 
-            panic(err)
+        if err != nil {
+            return nil, err
         }
+    }
+
+    result := &SourceResult{}
+    overviewOnly := make(map[string]bool) // offered without cached metadata
+
+    for _, vault := range vaults {
 
-        var selectedIds []string
+        name := vault.Vault.Title
 
-        for _, item := range selected {
-            selectedIds = append(selectedIds, item.ID)
+        if len(accounts) > 1 {
+            name = vault.Account + " / " + name
         }
 
-        for _, connection := range connections {
-            if slices.Contains(selectedIds, connection.ID) {
-                exportable = append(exportable, connection)
+        if opts.MetadataOnly {
+            overviews, err := getDatabaseItemOverviews(vault.Client, vault.Vault.ID, categories)
+
+            if err != nil {
+                return nil, err
+            }
+
+            if len(overviews) > 0 {
+                result.Groups = append(result.Groups, &ui.Group{
+                    ID:          vault.Vault.ID,
+                    Name:        name,
+                    Description: vault.Vault.Description,
+                })
             }
+
+            // Items whose metadata isn't cached are offered with what their
+            // overview tells, and only read in full once picked
+            for _, overview := range overviews {
+                connection, cached := connectionFromOverview(overview, cache)
+
+                if !cached {
+                    overviewOnly[connection.ID] = true
+                }
+
+                connection.Account = vault.Account
+                result.Connections = append(result.Connections, connection)
+            }
+
+            continue
         }
-    }
 
-    var jsonString []byte
+        items, err := getDatabaseItems(vault.Client, vault.Vault.ID, categories)
 
-    if groupByVault {
-        out := convertGroupedConnections(exportable, vaults)
+        if err != nil {
+            return nil, err
+        }
 
-        jsonString, err = json.MarshalIndent(out, "", "  ")
+        vaultResult, err := parseAvailableConnections(items, []*onepassword.Vault{{
+            ID:          vault.Vault.ID,
+            Title:       name,
+            Description: vault.Vault.Description,
+        }})
 
-        if (err != nil) {
-            panic(err)
+        if err != nil {
+            return nil, err
         }
-    } else {
-        out := convertConnections(exportable)
 
-        jsonString, err = json.MarshalIndent(out, "", "  ")
+        // Only offer vaults with database items
+        if len(items) > 0 {
+            result.Groups = append(result.Groups, vaultResult.Groups...)
+        }
 
-        if (err != nil) {
-            panic(err)
+        for _, connection := range vaultResult.Connections {
+            connection.Account = vault.Account
         }
+
+        result.Connections = append(result.Connections, vaultResult.Connections...)
+        result.Skipped = append(result.Skipped, vaultResult.Skipped...)
     }
 
-    encrypted, err := rncryptor.Encrypt(password, jsonString)
+    if opts.Cache {
+        // What overviews tell isn't metadata worth caching
+        cached := *result
+        cached.Connections = slices.DeleteFunc(slices.Clone(result.Connections), func(c *AvailableConnection) bool {
+            return overviewOnly[c.ID]
+        })
+
+        if cache == nil {
+            cache = newMetadataCache(cached.Connections)
+            cache.Categories = normalizeCategories(opts.Categories)
+        } else {
+            cache.update(cached.Connections)
+        }
+
+        if err := saveMetadataCache(opts, cache); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not write metadata cache: %s\n", err)
+        }
+    }
 
-    if (err != nil) {
-        panic(err)
+    if opts.MetadataOnly {
+        result.Resolve = func(selected []*AvailableConnection) ([]*AvailableConnection, error) {
+            return resolveOnePassword(opts, auth, cache, selected)
+        }
     }
 
-    err = os.WriteFile(outputFile + ".tableplusconnection", encrypted, 0666)
+    return result, nil
+}
 
-    if (err != nil) {
-        panic(err)
+// connectionFromOverview creates a connection without secrets from an item
+// overview. Overviews don't include fields, so the host, port and the like
+// are taken from the metadata cache, which reports whether it has the same
+// version of the item.
+func connectionFromOverview(overview onepassword.ItemOverview, cache *MetadataCache) (*AvailableConnection, bool) {
+    connection := &AvailableConnection{
+        ID:        overview.ID,
+        GroupID:   overview.VaultID,
+        Name:      overview.Title,
+        Category:  categoryName(overview.Category),
+        Tags:      overview.Tags,
+        UpdatedAt: overview.UpdatedAt,
     }
 
-    if open {
-        fmt.Println("Opening")
+    if cache == nil {
+        return connection, false
+    }
 
-        err = openWithApp("TablePlus", outputFile + ".tableplusconnection")
+    m, ok := cache.lookup(overview.ID)
 
-        if (err != nil) {
-            panic(err)
-        }
-    } else {
-        fmt.Println("Exported")
+    if !ok || !m.UpdatedAt.Equal(overview.UpdatedAt) {
+        return connection, false
     }
+
+    connection.Address = m.Host
+    connection.Port = m.Port
+    connection.Driver = m.Driver
+    connection.Database = m.Database
+    connection.Environment = m.Environment
+
+    return connection, true
 }
 
-func getDatabaseItems() ([]*onepassword.Item, []*onepassword.Vault, error) {
-    accountName := flag.Arg(0);
+// resolveOnePassword reads the items of the selected connections, which
+// were offered from overviews and the metadata cache, and refreshes their
+// metadata in the cache if there is one. Items that were deleted or can't
+// be exported are reported and left out; the others keep their order.
+func resolveOnePassword(opts ExportOptions, auth string, cache *MetadataCache, selected []*AvailableConnection) ([]*AvailableConnection, error) {
+    type vaultKey struct {
+        Account string
+        VaultID string
+    }
+
+    itemIDs := make(map[vaultKey][]string)
+    var keys []vaultKey
+
+    for _, c := range selected {
+        key := vaultKey{Account: c.Account, VaultID: c.GroupID}
+
+        if _, ok := itemIDs[key]; !ok {
+            keys = append(keys, key)
+        }
 
-    if (accountName == "") {
-        return nil, nil, errors.New("Account name is required as the first argument")
+        itemIDs[key] = append(itemIDs[key], c.ID)
     }
 
-    client, err := onepassword.NewClient(
-        context.Background(),
-        onepassword.WithDesktopAppIntegration(accountName),
-        onepassword.WithIntegrationInfo("TablePlus connections", "v0.1.0"),
-    )
+    clients := make(map[string]*onepassword.Client)
+    var resolved []*AvailableConnection
 
-    if err != nil {
-        return nil, nil, err
+    for _, key := range keys {
+        client, ok := clients[key.Account]
+
+        if !ok {
+            var err error
+            client, err = newOnePasswordClient(auth, key.Account)
+
+            if err != nil {
+                return nil, err
+            }
+
+            clients[key.Account] = client
+        }
+
+        response, err := client.Items().GetAll(context.Background(), key.VaultID, itemIDs[key])
+
+        if err != nil {
+            return nil, err
+        }
+
+        var items []*onepassword.Item
+
+        for _, item := range response.IndividualResponses {
+            if (item.Error != nil) {
+                fmt.Fprintf(os.Stderr, "Skipping item: %s\n", item.Error.Internal())
+                continue
+            }
+
+            items = append(items, item.Content)
+        }
+
+        vaultResult, err := parseAvailableConnections(items, nil)
+
+        if err != nil {
+            return nil, err
+        }
+
+        for _, skipped := range vaultResult.Skipped {
+            fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", skipped.Name, skipped.Reason)
+        }
+
+        for _, connection := range vaultResult.Connections {
+            connection.Account = key.Account
+        }
+
+        resolved = append(resolved, vaultResult.Connections...)
     }
 
-    vaultOverviews, err := client.Vaults().List(context.Background())
+    order := make(map[string]int)
 
-    if err != nil {
-        return nil, nil, err
+    for i, c := range selected {
+        order[c.ID] = i
     }
 
-    var databaseItems []*onepassword.Item
-    vaults := make(map[string]*onepassword.Vault)
+    slices.SortFunc(resolved, func(a, b *AvailableConnection) int {
+        return order[a.ID] - order[b.ID]
+    })
+
+    if cache == nil {
+        return resolved, nil
+    }
 
-    for _, vault := range vaultOverviews {
-        itemOverviews, err := client.Items().List(context.Background(), vault.ID)
+    cache.update(resolved)
+
+    if err := saveMetadataCache(opts, cache); err != nil {
+        fmt.Fprintf(os.Stderr, "Could not write metadata cache: %s\n", err)
+    }
+
+    return resolved, nil
+}
+
+// listOnePasswordVaults lists the vaults of every account, once per vault,
+// keeping only those matching allowed by name or ID if it is set.
+func listOnePasswordVaults(auth string, accounts []string, allowed []string) ([]onePasswordVault, error) {
+    var vaults []onePasswordVault
+    seen := make(map[string]bool)
+    matched := make(map[string]bool)
+
+    for _, account := range accounts {
+        client, err := newOnePasswordClient(auth, account)
 
         if err != nil {
-            return nil, nil, err
+            return nil, err
         }
 
-        var vaultDatabaseItemOverviewIds []string
+        overviews, err := client.Vaults().List(context.Background())
 
-        for _, itemOverview := range itemOverviews {
-            if itemOverview.Category == onepassword.ItemCategoryDatabase {
-                vaultDatabaseItemOverviewIds = append(vaultDatabaseItemOverviewIds, itemOverview.ID)
+        if err != nil {
+            return nil, err
+        }
 
-                if _, contains := vaults[itemOverview.VaultID]; !contains {
-                    actualVault, err := client.Vaults().Get(context.Background(), itemOverview.VaultID, onepassword.VaultGetParams{});
+        for _, vault := range overviews {
+            if seen[vault.ID] {
+                continue
+            }
 
-                    if err != nil {
-                        panic(err)
-                    }
+            if len(allowed) > 0 {
+                i := slices.IndexFunc(allowed, func(a string) bool {
+                    return a == vault.ID || strings.EqualFold(a, vault.Title)
+                })
 
-                    vaults[itemOverview.VaultID] = &actualVault
+                if i < 0 {
+                    continue
                 }
+
+                matched[allowed[i]] = true
             }
+
+            seen[vault.ID] = true
+            vaults = append(vaults, onePasswordVault{Account: account, Client: client, Vault: vault})
         }
+    }
 
-        items, err := client.Items().GetAll(context.Background(), vault.ID, vaultDatabaseItemOverviewIds)
+    for _, a := range allowed {
+        if !matched[a] {
+            fmt.Fprintf(os.Stderr, "No vault named %q\n", a)
+        }
+    }
 
-        for _, item := range items.IndividualResponses {
-            if (item.Error != nil) {
-                return nil, nil, errors.New(string(item.Error.Internal()))
-            }
+    return vaults, nil
+}
+
+// pickVaults lets the user pick which of the vaults to read.
+func pickVaults(vaults []onePasswordVault, withAccount bool) ([]onePasswordVault, error) {
+    var selectable []ui.Item
+
+    for _, vault := range vaults {
+        description := vault.Vault.Description
+
+        if withAccount {
+            description = vault.Account
+        }
+
+        selectable = append(selectable, ui.Item{
+            ID: vault.Vault.ID,
+            TitleText: vault.Vault.Title,
+            DescriptionText: description,
+            Details: []ui.Detail{
+                {Label: "Account", Value: vault.Account},
+                {Label: "Items", Value: strconv.Itoa(int(vault.Vault.ActiveItemCount))},
+                {Label: "Description", Value: vault.Vault.Description},
+            },
+            Selected: true,
+        })
+    }
+
+    result, err := ui.Run(selectable, nil, ui.Options{Title: "Which vaults should be searched for connections?"})
+
+    if err != nil {
+        return nil, err
+    }
 
-            databaseItems = append(databaseItems, item.Content)
+    var picked []onePasswordVault
+
+    for _, vault := range vaults {
+        if slices.ContainsFunc(result.Selected, func(it ui.Item) bool { return it.ID == vault.Vault.ID }) {
+            picked = append(picked, vault)
         }
     }
 
-    return databaseItems, slices.Collect(maps.Values(vaults)), nil
+    return picked, nil
 }
 
-func parseAvailableConnections(items []*onepassword.Item, vaults []*onepassword.Vault) ([]*AvailableConnection, []*ui.Group, error) {
-    var availableConnections []*AvailableConnection
-    var groups []*ui.Group
+// getDatabaseItemOverviews lists the database items of a vault, and the
+// items of the other categories that may describe a database, without
+// reading their fields.
+func getDatabaseItemOverviews(client *onepassword.Client, vaultID string, categories []onepassword.ItemCategory) ([]onepassword.ItemOverview, error) {
+    itemOverviews, err := client.Items().List(context.Background(), vaultID)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var databaseItems []onepassword.ItemOverview
+
+    for _, itemOverview := range itemOverviews {
+        if itemOverview.Category == onepassword.ItemCategoryDatabase ||
+            slices.Contains(categories, itemOverview.Category) && isCandidateItem(itemOverview) {
+            databaseItems = append(databaseItems, itemOverview)
+        }
+    }
+
+    return databaseItems, nil
+}
+
+// getDatabaseItems reads the database items of a vault, including secrets.
+func getDatabaseItems(client *onepassword.Client, vaultID string, categories []onepassword.ItemCategory) ([]*onepassword.Item, error) {
+    itemOverviews, err := getDatabaseItemOverviews(client, vaultID, categories)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var databaseItemIds []string
+
+    for _, itemOverview := range itemOverviews {
+        databaseItemIds = append(databaseItemIds, itemOverview.ID)
+    }
+
+    return getItems(client, vaultID, databaseItemIds)
+}
+
+// getItems reads items of a vault, including secrets.
+func getItems(client *onepassword.Client, vaultID string, ids []string) ([]*onepassword.Item, error) {
+    if len(ids) == 0 {
+        return nil, nil
+    }
+
+    items, err := client.Items().GetAll(context.Background(), vaultID, ids)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var databaseItems []*onepassword.Item
+
+    for _, item := range items.IndividualResponses {
+        if (item.Error != nil) {
+            return nil, errors.New(string(item.Error.Internal()))
+        }
+
+        databaseItems = append(databaseItems, item.Content)
+    }
+
+    return databaseItems, nil
+}
+
+func parseAvailableConnections(items []*onepassword.Item, vaults []*onepassword.Vault) (*SourceResult, error) {
+    result := &SourceResult{}
 
     for _, vault := range vaults {
-        groups = append(groups, &ui.Group{
+        result.Groups = append(result.Groups, &ui.Group{
             ID:          vault.ID,
             Name:        vault.Title,
-            Description: "Idk",
+            Description: vault.Description,
         })
     }
 
     for _, item := range items {
+        if item.Category != onepassword.ItemCategoryDatabase {
+            connection, ok := connectionFromItem(item)
+
+            if !ok {
+                continue
+            }
+
+            if missing := completeConnection(connection); len(missing) > 0 {
+                result.Skipped = append(result.Skipped, SkippedItem{
+                    ID: item.ID,
+                    GroupID: item.VaultID,
+                    Name: item.Title,
+                    Reason: "missing or invalid " + strings.Join(missing, ", "),
+                })
+                continue
+            }
+
+            result.Connections = append(result.Connections, connection)
+            continue
+        }
+
         var address *string
         var port *int
         var username *string
         var password *string
         passwordIsCommand := false
+        connection := &AvailableConnection{}
+        var ssh SSHTunnel
+        var connectionString *AvailableConnection
 
         for _, field := range item.Fields {
+            fieldTitle := strings.ToLower(strings.TrimSpace(field.Title))
+
+            switch {
+            case field.ID == "database" && connection.Database == "":
+                connection.Database = field.Value
+
+            case field.ID == "database_type" && connection.Driver == "":
+                connection.Driver = normalizeDriver(field.Value)
+
+            case fieldTitle == "driver" && field.Value != "":
+                connection.Driver = normalizeDriver(field.Value)
+
+            case fieldTitle == "environment" || fieldTitle == "env":
+                connection.Environment = normalizeEnvironment(field.Value)
+
+            case fieldTitle == "tls mode" || fieldTitle == "ssl mode" || fieldTitle == "sslmode":
+                if mode, ok := parseTLSMode(field.Value); ok {
+                    connection.TLSMode = mode
+                }
+
+            case slices.Contains(connectionStringKeys, fieldTitle) && connectionString == nil:
+                parsed := &AvailableConnection{}
+
+                if parseConnectionString(field.Value, parsed) {
+                    connectionString = parsed
+                }
+
+            case fieldTitle == "ssh host":
+                ssh.Host = field.Value
+
+            case fieldTitle == "ssh port":
+                if sshPort, err := strconv.Atoi(field.Value); err == nil {
+                    ssh.Port = sshPort
+                }
+
+            case fieldTitle == "ssh user" || fieldTitle == "ssh username":
+                ssh.User = field.Value
+
+            case fieldTitle == "ssh password":
+                ssh.Password = field.Value
+            }
+
             if (field.ID == "hostname" && address == nil) {
                 address = &field.Value
             }
@@ -252,23 +657,77 @@ func parseAvailableConnections(items []*onepassword.Item, vaults []*onepassword.
             }
         }
 
-        if (address == nil || port == nil || username == nil || password == nil) {
+        // A connection string fills in what the other fields leave empty
+        if connectionString != nil {
+            if address == nil || *address == "" {
+                address = &connectionString.Address
+            }
+
+            if port == nil {
+                port = &connectionString.Port
+            }
+
+            if username == nil || *username == "" {
+                username = &connectionString.Username
+            }
+
+            if password == nil || *password == "" {
+                password = &connectionString.Password
+            }
+
+            if connection.Driver == "" {
+                connection.Driver = connectionString.Driver
+            }
+
+            if connection.Database == "" {
+                connection.Database = connectionString.Database
+            }
+
+            if connection.TLSMode == TLSModeDisable {
+                connection.TLSMode = connectionString.TLSMode
+            }
+        }
+
+        var missing []string
+
+        for name, value := range map[string]bool{"hostname": address != nil, "port": port != nil, "username": username != nil, "password": password != nil} {
+            if !value {
+                missing = append(missing, name)
+            }
+        }
+
+        if len(missing) > 0 {
+            slices.Sort(missing)
+
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID: item.ID,
+                GroupID: item.VaultID,
+                Name: item.Title,
+                Reason: "missing or invalid " + strings.Join(missing, ", "),
+            })
             continue
         }
 
-        availableConnections = append(availableConnections, &AvailableConnection{
-            ID: item.ID,
-            GroupID: item.VaultID,
-            Name: item.Title,
-            Address: *address,
-            Port: *port,
-            Username: *username,
-            Password: *password,
-            PasswordIsCommand: passwordIsCommand,
-        })
+        if ssh.Host != "" {
+            connection.SSH = &ssh
+        }
+
+        connection.ID = item.ID
+        connection.GroupID = item.VaultID
+        connection.Name = item.Title
+        connection.Address = *address
+        connection.Port = *port
+        connection.Username = *username
+        connection.Password = *password
+        connection.PasswordIsCommand = passwordIsCommand
+        connection.Category = categoryName(item.Category)
+        connection.Tags = item.Tags
+        connection.UpdatedAt = item.UpdatedAt
+
+        result.Connections = append(result.Connections, connection)
     }
 
-    return availableConnections, groups, nil
+    return result, nil
 }
 
 func convertConnections(in []*AvailableConnection) []*OutputConnection {
@@ -281,7 +740,9 @@ func convertConnections(in []*AvailableConnection) []*OutputConnection {
             databasePasswordMode = 3
         }
 
-        out = append(out, &OutputConnection{
+        environment := connectionEnvironment(c)
+
+        output := &OutputConnection{
             DatabaseUser:         c.Username,
             ServerAddress:        c.Address,
             DatabaseHost:         c.Address,
@@ -289,11 +750,13 @@ func convertConnections(in []*AvailableConnection) []*OutputConnection {
             DatabasePassword:     c.Password,
             DatabasePasswordMode: databasePasswordMode,
             DatabasePort:         fmt.Sprintf("%d", c.Port),
+            DatabaseName:         c.Database,
+            Driver:               connectionDriver(c),
+            Enviroment:           environment,
+            StatusColor:          environmentColors[environment],
+            TLSMode:              c.TLSMode,
 
-            // Defaults that match your sample JSON, TODO: fix
-            Driver:              "PostgreSQL",
-            Enviroment:          "local",
-            StatusColor:         "#007F3D",
+            // Defaults that match your sample JSON
             ServerPort:          "22",
             TlsKeyName:          "Key...,Cert...,CA Cert...",
             TlsKeyPaths:         []string{"", "", ""},
@@ -305,23 +768,44 @@ func convertConnections(in []*AvailableConnection) []*OutputConnection {
             RecentUsedRestoreOptions: []string{},
             SectionStates:       map[string]any{},
             Favorites:           map[string]any{},
-        })
+        }
+
+        if c.SSH != nil {
+            output.IsOverSSH = 1
+            output.ServerAddress = c.SSH.Host
+            output.ServerUser = c.SSH.User
+            output.ServerPassword = c.SSH.Password
+
+            if c.SSH.Port != 0 {
+                output.ServerPort = strconv.Itoa(c.SSH.Port)
+            }
+        }
+
+        out = append(out, output)
     }
 
     return out
 }
 
-func convertGroupedConnections(in []*AvailableConnection, groups []*onepassword.Vault) []*OutputGroup {
-    var out []*OutputGroup
+// convertGroupedConnections converts connections into the grouped export
+// format. The result is a mixed top-level list: one *OutputGroup per vault,
+// sorted by name, followed by every connection without a vault as a plain
+// *OutputConnection. When ungroupedName is set, those connections are put in
+// a group with that name instead.
+func convertGroupedConnections(in []*AvailableConnection, groups []*ui.Group, ungroupedName string) []any {
+    var out []any
+    var outGroups []*OutputGroup
+    var ungrouped []*AvailableConnection
     grouped := make(map[string][]*AvailableConnection)
     groupNames := make(map[string]string, len(groups))
 
     for _, group := range groups {
-        groupNames[group.ID] = group.Title
+        groupNames[group.ID] = group.Name
     }
 
     for _, connection := range in {
         if connection.GroupID == "" {
+            ungrouped = append(ungrouped, connection)
             continue
         }
 
@@ -329,10 +813,38 @@ func convertGroupedConnections(in []*AvailableConnection, groups []*onepassword.
     }
 
     for groupID, connections := range grouped {
-        out = append(out, &OutputGroup{
-            Name: groupNames[groupID],
+        name, ok := groupNames[groupID]
+
+        if !ok || name == "" {
+            name = groupID
+        }
+
+        outGroups = append(outGroups, &OutputGroup{
+            Name: name,
             Connections: convertConnections(connections),
+            Groups: []int{},
+        })
+    }
+
+    if len(ungrouped) > 0 && ungroupedName != "" {
+        outGroups = append(outGroups, &OutputGroup{
+            Name: ungroupedName,
+            Connections: convertConnections(ungrouped),
+            Groups: []int{},
         })
+        ungrouped = nil
+    }
+
+    slices.SortStableFunc(outGroups, func(a, b *OutputGroup) int {
+        return strings.Compare(a.Name, b.Name)
+    })
+
+    for _, group := range outGroups {
+        out = append(out, group)
+    }
+
+    for _, connection := range convertConnections(ungrouped) {
+        out = append(out, connection)
     }
 
     return out
@@ -350,17 +862,6 @@ func openWithApp(app, target string) error {
     return cmd.Run()
 }
 
-type AvailableConnection struct {
-    ID                string
-    GroupID           string
-    Name              string
-    Address           string
-    Port              int
-    Username          string
-    Password          string
-    PasswordIsCommand bool
-}
-
 type OutputConnection struct {
     DatabaseType              string                 `json:"DatabaseType"`
     TlsKeyName                string                 `json:"TlsKeyName"`
@@ -0,0 +1,246 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "slices"
+    "strings"
+
+    "github.com/1password/onepassword-sdk-go"
+    "gopkg.in/yaml.v3"
+
+    "tableplus-connections/ui"
+)
+
+// secretRefPrefix starts the 1Password secret references manifests hold
+// instead of secrets: op://vault/item/field.
+const secretRefPrefix = "op://"
+
+// Manifest is a YAML file describing connections, checked in next to the
+// code using them. Secrets are 1Password secret references.
+type Manifest struct {
+    Account     string               `yaml:"account"` // 1Password account the references are resolved in
+    Connections []ManifestConnection `yaml:"connections"`
+}
+
+type ManifestConnection struct {
+    ID          string     `yaml:"id"` // defaults to the name
+    Name        string     `yaml:"name"`
+    Group       string     `yaml:"group"`
+    Driver      string     `yaml:"driver"`
+    Host        string     `yaml:"host"`
+    Port        int        `yaml:"port"`
+    Database    string     `yaml:"database"`
+    User        string     `yaml:"user"`
+    Password    string     `yaml:"password"`
+    Environment string     `yaml:"environment"`
+    TLSMode     string     `yaml:"tls_mode"`
+    Tags        []string   `yaml:"tags"`
+    SSH         *SSHTunnel `yaml:"ssh"` // host, port, user, password
+}
+
+// loadManifest reads the connections of a manifest. The secret references
+// are resolved through the 1Password SDK once connections are picked,
+// leaving out those that fail to resolve.
+func loadManifest(opts ExportOptions) (*SourceResult, error) {
+    if opts.SourcePath == "" {
+        return nil, errors.New("The manifest source needs the manifest file as --source-path")
+    }
+
+    data, err := os.ReadFile(opts.SourcePath)
+
+    if err != nil {
+        return nil, err
+    }
+
+    manifest := &Manifest{}
+    decoder := yaml.NewDecoder(bytes.NewReader(data))
+    decoder.KnownFields(true)
+
+    if err := decoder.Decode(manifest); err != nil {
+        return nil, fmt.Errorf("%s: %w", opts.SourcePath, err)
+    }
+
+    result := &SourceResult{}
+    groups := make(map[string]bool)
+    ids := make(map[string]bool)
+
+    for i, entry := range manifest.Connections {
+        connection, err := entry.connection()
+
+        if err != nil {
+            return nil, fmt.Errorf("%s: connection %d: %w", opts.SourcePath, i+1, err)
+        }
+
+        if ids[connection.ID] {
+            return nil, fmt.Errorf("%s: duplicate connection %q, set an id", opts.SourcePath, connection.ID)
+        }
+
+        ids[connection.ID] = true
+
+        if entry.Group != "" && !groups[entry.Group] {
+            groups[entry.Group] = true
+            result.Groups = append(result.Groups, &ui.Group{ID: connection.GroupID, Name: entry.Group})
+        }
+
+        if missing := completeConnection(connection); len(missing) > 0 {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:      connection.ID,
+                GroupID: connection.GroupID,
+                Name:    connection.Name,
+                Reason:  "missing or invalid " + strings.Join(missing, ", "),
+            })
+            continue
+        }
+
+        result.Connections = append(result.Connections, connection)
+    }
+
+    account := manifest.Account
+
+    if account == "" && len(opts.Accounts) > 0 {
+        account = opts.Accounts[0]
+    }
+
+    result.Resolve = func(selected []*AvailableConnection) ([]*AvailableConnection, error) {
+        return resolveSecretRefs(selected, opts.Auth, account)
+    }
+
+    return result, nil
+}
+
+func (m ManifestConnection) connection() (*AvailableConnection, error) {
+    if m.Name == "" {
+        return nil, errors.New("missing name")
+    }
+
+    connection := &AvailableConnection{
+        ID:       "manifest:" + m.Name,
+        Name:     m.Name,
+        Address:  m.Host,
+        Port:     m.Port,
+        Username: m.User,
+        Password: m.Password,
+        Tags:     m.Tags,
+        Database: m.Database,
+        SSH:      m.SSH,
+    }
+
+    if m.ID != "" {
+        connection.ID = "manifest:" + m.ID
+    }
+
+    if m.Group != "" {
+        connection.GroupID = "manifest-group:" + m.Group
+    }
+
+    if m.Driver != "" {
+        connection.Driver = normalizeDriver(m.Driver)
+
+        if connection.Driver == "" {
+            return nil, fmt.Errorf("unknown driver %q", m.Driver)
+        }
+    }
+
+    if m.Environment != "" {
+        connection.Environment = normalizeEnvironment(m.Environment)
+
+        if connection.Environment == "" {
+            return nil, fmt.Errorf("unknown environment %q", m.Environment)
+        }
+    }
+
+    if m.TLSMode != "" {
+        mode, ok := parseTLSMode(m.TLSMode)
+
+        if !ok {
+            return nil, fmt.Errorf("unknown TLS mode %q", m.TLSMode)
+        }
+
+        connection.TLSMode = mode
+    }
+
+    return connection, nil
+}
+
+// secretRefFields returns the fields of a connection that may hold secret
+// references.
+func secretRefFields(c *AvailableConnection) []*string {
+    fields := []*string{&c.Address, &c.Username, &c.Password, &c.Database}
+
+    if c.SSH != nil {
+        fields = append(fields, &c.SSH.Host, &c.SSH.User, &c.SSH.Password)
+    }
+
+    return fields
+}
+
+// resolveSecretRefs replaces the secret references of the connections with
+// the secrets, resolving them all at once. Connections with a reference
+// that doesn't resolve are left out.
+func resolveSecretRefs(connections []*AvailableConnection, auth, account string) ([]*AvailableConnection, error) {
+    var refs []string
+
+    for _, connection := range connections {
+        for _, field := range secretRefFields(connection) {
+            if strings.HasPrefix(*field, secretRefPrefix) && !slices.Contains(refs, *field) {
+                refs = append(refs, *field)
+            }
+        }
+    }
+
+    if len(refs) == 0 {
+        return connections, nil
+    }
+
+    client, err := newOnePasswordClient(auth, account)
+
+    if err != nil {
+        return nil, err
+    }
+
+    response, err := client.Secrets().ResolveAll(context.Background(), refs)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var resolved []*AvailableConnection
+
+    for _, connection := range connections {
+        if err := replaceSecretRefs(connection, response); err != nil {
+            fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", connection.Name, err)
+            continue
+        }
+
+        resolved = append(resolved, connection)
+    }
+
+    return resolved, nil
+}
+
+func replaceSecretRefs(connection *AvailableConnection, response onepassword.ResolveAllResponse) error {
+    for _, field := range secretRefFields(connection) {
+        if !strings.HasPrefix(*field, secretRefPrefix) {
+            continue
+        }
+
+        secret := response.IndividualResponses[*field]
+
+        switch {
+        case secret.Error == nil && secret.Content != nil:
+            *field = secret.Content.Secret
+        case secret.Error == nil:
+            return fmt.Errorf("%s did not resolve", *field)
+        case secret.Error.Type == onepassword.ResolveReferenceErrorTypeVariantParsing:
+            return fmt.Errorf("%s: %s", *field, secret.Error.Parsing())
+        default:
+            return fmt.Errorf("%s: %s", *field, secret.Error.Type)
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io/fs"
+    "maps"
+    "os"
+    "os/exec"
+    "path"
+    "path/filepath"
+    "slices"
+    "strings"
+
+    "tableplus-connections/ui"
+)
+
+// passStoreDir returns the password store read when --source-path isn't
+// set: $PASSWORD_STORE_DIR, ~/.password-store, or gopass' root store.
+func passStoreDir() (string, error) {
+    if dir := os.Getenv("PASSWORD_STORE_DIR"); dir != "" {
+        return dir, nil
+    }
+
+    home, err := os.UserHomeDir()
+
+    if err != nil {
+        return "", err
+    }
+
+    for _, dir := range []string{
+        filepath.Join(home, ".password-store"),
+        filepath.Join(home, ".local", "share", "gopass", "stores", "root"),
+    } {
+        if info, err := os.Stat(dir); err == nil && info.IsDir() {
+            return dir, nil
+        }
+    }
+
+    return "", errors.New("No password store found, set --source-path or PASSWORD_STORE_DIR")
+}
+
+// loadPass reads the connections of a pass (or gopass) password store,
+// decrypting every entry with gpg. The first line of an entry is the
+// password, the lines after it "key: value" pairs like "host: db.internal";
+// entries without such lines aren't connections. Every directory is a
+// group, with the directory above it as its parent, named by its path in
+// the store as groups aren't shown nested.
+func loadPass(opts ExportOptions) (*SourceResult, error) {
+    dir := opts.SourcePath
+
+    if dir == "" {
+        var err error
+
+        if dir, err = passStoreDir(); err != nil {
+            return nil, err
+        }
+    }
+
+    if _, err := exec.LookPath("gpg"); err != nil {
+        return nil, errors.New("The pass source needs gpg to decrypt entries")
+    }
+
+    result := &SourceResult{}
+    groups := make(map[string]*ui.Group)
+
+    err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+
+        if strings.HasPrefix(d.Name(), ".") && file != dir {
+            if d.IsDir() {
+                return filepath.SkipDir
+            }
+
+            return nil
+        }
+
+        if d.IsDir() || !strings.HasSuffix(d.Name(), ".gpg") {
+            return nil
+        }
+
+        rel, err := filepath.Rel(dir, file)
+
+        if err != nil {
+            return err
+        }
+
+        name := strings.TrimSuffix(filepath.ToSlash(rel), ".gpg")
+        plain, err := decryptPassEntry(file)
+
+        if err != nil {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:     "pass:" + name,
+                Name:   path.Base(name),
+                Reason: err.Error(),
+            })
+            return nil
+        }
+
+        connection, ok := parsePassEntry(plain)
+
+        if !ok {
+            return nil
+        }
+
+        connection.ID = "pass:" + name
+        connection.Name = path.Base(name)
+
+        if parent := path.Dir(name); parent != "." {
+            connection.GroupID = pathGroup("pass:", parent, groups).ID
+        }
+
+        if missing := completeConnection(connection); len(missing) > 0 {
+            result.Skipped = append(result.Skipped, SkippedItem{
+                ID:      connection.ID,
+                GroupID: connection.GroupID,
+                Name:    connection.Name,
+                Reason:  "missing or invalid " + strings.Join(missing, ", "),
+            })
+            return nil
+        }
+
+        result.Connections = append(result.Connections, connection)
+
+        return nil
+    })
+
+    if err != nil {
+        return nil, err
+    }
+
+    for _, dir := range slices.Sorted(maps.Keys(groups)) {
+        result.Groups = append(result.Groups, groups[dir])
+    }
+
+    return result, nil
+}
+
+// decryptPassEntry decrypts an entry with gpg, which asks for the key's
+// passphrase through its agent when needed.
+func decryptPassEntry(file string) ([]byte, error) {
+    var stderr bytes.Buffer
+    cmd := exec.Command("gpg", "--quiet", "--yes", "--decrypt", file)
+    cmd.Stderr = &stderr
+
+    out, err := cmd.Output()
+
+    if err != nil {
+        message := strings.TrimSpace(stderr.String())
+
+        if message == "" {
+            message = err.Error()
+        }
+
+        return nil, fmt.Errorf("gpg: %s", message)
+    }
+
+    return out, nil
+}
+
+// parsePassEntry parses a decrypted entry, reporting false when its lines
+// don't describe a database.
+func parsePassEntry(plain []byte) (*AvailableConnection, bool) {
+    connection := &AvailableConnection{}
+    scanner := bufio.NewScanner(bytes.NewReader(plain))
+    var password string
+
+    if scanner.Scan() {
+        password = strings.TrimRight(scanner.Text(), "\r")
+    }
+
+    for scanner.Scan() {
+        if key, value, ok := strings.Cut(scanner.Text(), ":"); ok {
+            setConnectionField(connection, key, value)
+        }
+    }
+
+    // The first line wins over "password:" lines
+    if password != "" {
+        connection.Password = password
+    }
+
+    return connection, describesDatabase(connection)
+}
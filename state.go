@@ -0,0 +1,114 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+    "time"
+)
+
+// SelectionState is what the picker remembers for an account between runs.
+type SelectionState struct {
+    Selected  []string  `json:"selected"`
+    Known     []string  `json:"known"` // every item ID offered, selected or not
+    Grouped   bool      `json:"grouped"`
+    UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// StateFile holds the remembered selections of every account.
+type StateFile struct {
+    Accounts map[string]*SelectionState `json:"accounts"`
+}
+
+// stateKey returns the key the selection of an export is remembered under:
+// the source and its file for file based sources, otherwise the account
+// names, or the authentication method when there are none.
+func stateKey(opts ExportOptions) string {
+    if opts.Source != "1password" {
+        path, err := filepath.Abs(opts.SourcePath)
+
+        if err != nil {
+            path = opts.SourcePath
+        }
+
+        return opts.Source + ":" + path
+    }
+
+    if len(opts.Accounts) > 0 {
+        return strings.Join(slices.Sorted(slices.Values(opts.Accounts)), ",")
+    }
+
+    auth, err := resolveAuth(opts.Auth)
+
+    if err != nil {
+        return opts.Auth
+    }
+
+    return auth
+}
+
+// statePath returns the location of the state file, next to the config file.
+func statePath() (string, error) {
+    dir, err := configDir()
+
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(dir, "state.json"), nil
+}
+
+// loadState reads the state file. A missing file is an empty state.
+func loadState() (*StateFile, error) {
+    state := &StateFile{Accounts: make(map[string]*SelectionState)}
+
+    path, err := statePath()
+
+    if err != nil {
+        return nil, err
+    }
+
+    data, err := os.ReadFile(path)
+
+    if errors.Is(err, os.ErrNotExist) {
+        return state, nil
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    if err := json.Unmarshal(data, state); err != nil {
+        return nil, err
+    }
+
+    if state.Accounts == nil {
+        state.Accounts = make(map[string]*SelectionState)
+    }
+
+    return state, nil
+}
+
+// saveState writes the state file, readable only by the current user.
+func saveState(state *StateFile) error {
+    path, err := statePath()
+
+    if err != nil {
+        return err
+    }
+
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+
+    data, err := json.MarshalIndent(state, "", "  ")
+
+    if err != nil {
+        return err
+    }
+
+    return os.WriteFile(path, data, 0600)
+}
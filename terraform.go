@@ -0,0 +1,323 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "maps"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+)
+
+// terraformState is the part of a version 4 state file connections are
+// read from.
+type terraformState struct {
+    Version int `json:"version"`
+    Outputs map[string]struct {
+        Value any `json:"value"`
+    } `json:"outputs"`
+    Resources []struct {
+        Module    string `json:"module"`
+        Mode      string `json:"mode"`
+        Type      string `json:"type"`
+        Name      string `json:"name"`
+        Instances []struct {
+            IndexKey   any            `json:"index_key"`
+            Attributes map[string]any `json:"attributes"`
+        } `json:"instances"`
+    } `json:"resources"`
+}
+
+// terraformResources maps the resource types databases are read from to
+// the functions reading their attributes.
+var terraformResources = map[string]func(attributes map[string]any) []*AvailableConnection{
+    "aws_db_instance":                    awsDBInstance,
+    "aws_rds_cluster":                    awsRDSCluster,
+    "google_sql_database_instance":       googleSQLInstance,
+    "azurerm_postgresql_flexible_server": azurePostgreSQLServer,
+}
+
+// loadTerraform reads the databases of a terraform state file, the one in
+// --source-path or ./terraform.tfstate: the instances of known resource
+// types, and outputs that are connection strings or objects with host,
+// port and such keys. The credentials of the picked connections are read
+// from the 1Password item --secret-ref names.
+func loadTerraform(opts ExportOptions) (*SourceResult, error) {
+    file := opts.SourcePath
+
+    if file == "" {
+        file = "terraform.tfstate"
+    }
+
+    if info, err := os.Stat(file); err == nil && info.IsDir() {
+        file = filepath.Join(file, "terraform.tfstate")
+    }
+
+    data, err := os.ReadFile(file)
+
+    if err != nil {
+        return nil, err
+    }
+
+    state := &terraformState{}
+
+    if err := json.Unmarshal(data, state); err != nil {
+        return nil, fmt.Errorf("%s: %w", file, err)
+    }
+
+    if state.Version != 4 {
+        return nil, fmt.Errorf("%s: unsupported state version %d", file, state.Version)
+    }
+
+    result := &SourceResult{}
+    group := fileGroup(result, file)
+    var connections []*AvailableConnection
+
+    for _, resource := range state.Resources {
+        read, ok := terraformResources[resource.Type]
+
+        if !ok || resource.Mode != "managed" {
+            continue
+        }
+
+        for _, instance := range resource.Instances {
+            address := resource.Type + "." + resource.Name
+
+            if resource.Module != "" {
+                address = resource.Module + "." + address
+            }
+
+            switch key := instance.IndexKey.(type) {
+            case string:
+                address += fmt.Sprintf("[%q]", key)
+            case float64:
+                address += fmt.Sprintf("[%d]", int(key))
+            }
+
+            for _, connection := range read(instance.Attributes) {
+                connection.ID = "terraform:" + address + connection.ID
+
+                if connection.Name == "" {
+                    connection.Name = address
+                }
+
+                connections = append(connections, connection)
+            }
+        }
+    }
+
+    for _, name := range slices.Sorted(maps.Keys(state.Outputs)) {
+        connection := &AvailableConnection{ID: "terraform:output." + name, Name: name}
+
+        switch value := state.Outputs[name].Value.(type) {
+        case string:
+            if !parseConnectionString(value, connection) {
+                continue
+            }
+        case map[string]any:
+            for _, key := range slices.Sorted(maps.Keys(value)) {
+                if v, ok := value[key].(string); ok && isConnectionStringKey(key) {
+                    parseConnectionString(v, connection)
+                }
+            }
+
+            for _, key := range slices.Sorted(maps.Keys(value)) {
+                if !isConnectionStringKey(key) && value[key] != nil {
+                    setPrefixedField(connection, key, fmt.Sprint(value[key]))
+                }
+            }
+        default:
+            continue
+        }
+
+        // Outputs that are something else than a database's
+        if connection.Address == "" {
+            continue
+        }
+
+        connections = append(connections, connection)
+    }
+
+    refs := make(map[string]string)
+
+    for _, connection := range connections {
+        connection.GroupID = group
+
+        if opts.SecretRef != "" {
+            // Readers share the credentials of their cluster
+            name := strings.TrimSuffix(connection.Name, " (reader)")
+            refs[connection.ID] = strings.ReplaceAll(opts.SecretRef, "{name}", name)
+        }
+
+        addFileConnection(result, connection)
+    }
+
+    if len(refs) > 0 {
+        account := ""
+
+        if len(opts.Accounts) > 0 {
+            account = opts.Accounts[0]
+        }
+
+        result.Resolve = func(selected []*AvailableConnection) ([]*AvailableConnection, error) {
+            return selected, resolveTerraformCredentials(selected, refs, opts.Auth, account)
+        }
+    }
+
+    return result, nil
+}
+
+// resolveTerraformCredentials reads the username and password of the
+// connections from the fields of their 1Password items. Connections whose
+// item doesn't resolve keep the credentials of the state, if any.
+func resolveTerraformCredentials(connections []*AvailableConnection, refs map[string]string, auth, account string) error {
+    var secretRefs []string
+
+    for _, connection := range connections {
+        if ref, ok := refs[connection.ID]; ok {
+            secretRefs = append(secretRefs, ref+"/username", ref+"/password")
+        }
+    }
+
+    if len(secretRefs) == 0 {
+        return nil
+    }
+
+    client, err := newOnePasswordClient(auth, account)
+
+    if err != nil {
+        return err
+    }
+
+    response, err := client.Secrets().ResolveAll(context.Background(), secretRefs)
+
+    if err != nil {
+        return err
+    }
+
+    for _, connection := range connections {
+        ref, ok := refs[connection.ID]
+
+        if !ok {
+            continue
+        }
+
+        password := response.IndividualResponses[ref+"/password"]
+
+        if password.Error != nil || password.Content == nil {
+            fmt.Fprintf(os.Stderr, "No credentials for %s in %s\n", connection.Name, ref)
+            continue
+        }
+
+        connection.Password = password.Content.Secret
+
+        // The item's username goes with its password, over the state's
+        if username := response.IndividualResponses[ref+"/username"]; username.Error == nil && username.Content != nil {
+            connection.Username = username.Content.Secret
+        }
+    }
+
+    return nil
+}
+
+// terraformString returns a string attribute, or "" when it's unset.
+func terraformString(attributes map[string]any, keys ...string) string {
+    for _, key := range keys {
+        if value, ok := attributes[key].(string); ok && value != "" {
+            return value
+        }
+    }
+
+    return ""
+}
+
+func terraformPort(attributes map[string]any) int {
+    port, _ := attributes["port"].(float64)
+
+    return int(port)
+}
+
+// terraformDriver returns the driver of an RDS engine or a Cloud SQL
+// database version, like aurora-postgresql or MYSQL_8_0.
+func terraformDriver(engine string) string {
+    engine = strings.ToLower(engine)
+
+    switch {
+    case strings.Contains(engine, "postgres"):
+        return DriverPostgreSQL
+    case strings.Contains(engine, "mariadb"):
+        return DriverMariaDB
+    case strings.Contains(engine, "mysql"), engine == "aurora":
+        return DriverMySQL
+    case strings.Contains(engine, "sqlserver"):
+        return DriverSQLServer
+    case strings.Contains(engine, "oracle"):
+        return DriverOracle
+    }
+
+    return ""
+}
+
+func awsDBInstance(attributes map[string]any) []*AvailableConnection {
+    return []*AvailableConnection{{
+        Name:     terraformString(attributes, "identifier"),
+        Driver:   terraformDriver(terraformString(attributes, "engine")),
+        Address:  terraformString(attributes, "address"),
+        Port:     terraformPort(attributes),
+        Username: terraformString(attributes, "username"),
+        Password: terraformString(attributes, "password"),
+        Database: terraformString(attributes, "db_name", "name"),
+    }}
+}
+
+// awsRDSCluster returns the writer endpoint of a cluster, and its reader
+// endpoint as a connection of its own.
+func awsRDSCluster(attributes map[string]any) []*AvailableConnection {
+    writer := &AvailableConnection{
+        Name:     terraformString(attributes, "cluster_identifier"),
+        Driver:   terraformDriver(terraformString(attributes, "engine")),
+        Address:  terraformString(attributes, "endpoint"),
+        Port:     terraformPort(attributes),
+        Username: terraformString(attributes, "master_username"),
+        Password: terraformString(attributes, "master_password"),
+        Database: terraformString(attributes, "database_name"),
+    }
+
+    connections := []*AvailableConnection{writer}
+
+    if reader := terraformString(attributes, "reader_endpoint"); reader != "" {
+        connection := *writer
+        connection.ID = "/reader"
+        connection.Address = reader
+
+        if connection.Name != "" {
+            connection.Name += " (reader)"
+        }
+
+        connections = append(connections, &connection)
+    }
+
+    return connections
+}
+
+func googleSQLInstance(attributes map[string]any) []*AvailableConnection {
+    return []*AvailableConnection{{
+        Name:    terraformString(attributes, "name"),
+        Driver:  terraformDriver(terraformString(attributes, "database_version")),
+        Address: terraformString(attributes, "public_ip_address", "private_ip_address"),
+    }}
+}
+
+func azurePostgreSQLServer(attributes map[string]any) []*AvailableConnection {
+    return []*AvailableConnection{{
+        Name:     terraformString(attributes, "name"),
+        Driver:   DriverPostgreSQL,
+        Address:  terraformString(attributes, "fqdn"),
+        Username: terraformString(attributes, "administrator_login"),
+        Password: terraformString(attributes, "administrator_password"),
+        Database: "postgres",
+        TLSMode:  TLSModeRequire,
+    }}
+}
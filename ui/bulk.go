@@ -0,0 +1,85 @@
+package ui
+
+import (
+    "fmt"
+    "slices"
+    "strings"
+)
+
+// updateSelection sets the selection of every item to the result of fn,
+// which gets the item and whether it matches the current search. The cursor
+// stays on the same row.
+func (m *model) updateSelection(fn func(it Item, visible bool) bool) {
+    idx := m.list.Index()
+    visible := m.visibleIDs()
+
+    for i := range m.items {
+        m.items[i].Selected = fn(m.items[i], visible[m.items[i].ID])
+    }
+
+    m.rebuildListItems()
+    if idx < len(m.list.Items()) {
+        m.list.Select(idx)
+    }
+}
+
+// environments returns the distinct environments of all items, sorted.
+func (m *model) environments() []string {
+    var envs []string
+    for _, it := range m.items {
+        if it.Environment != "" && !slices.Contains(envs, it.Environment) {
+            envs = append(envs, it.Environment)
+        }
+    }
+    slices.Sort(envs)
+    return envs
+}
+
+// selectEnvironment adds every item of the environment at the given
+// position of environments() to the selection.
+func (m *model) selectEnvironment(index int) {
+    envs := m.environments()
+    if index < 0 || index >= len(envs) {
+        return
+    }
+
+    m.updateSelection(func(it Item, _ bool) bool {
+        return it.Selected || it.Environment == envs[index]
+    })
+}
+
+// environmentHelp lists the environment keys shown while picking one.
+func (m *model) environmentHelp() string {
+    var parts []string
+    for i, env := range m.environments() {
+        if i >= 9 {
+            break
+        }
+        parts = append(parts, fmt.Sprintf("[%d] %s", i+1, env))
+    }
+
+    if len(parts) == 0 {
+        return "no environments  [esc] cancel"
+    }
+
+    return "select environment: " + strings.Join(parts, "  ") + "  [esc] cancel"
+}
+
+// counterView renders the number of selected items, and the number of
+// items shown while searching.
+func (m *model) counterView() string {
+    selected := 0
+    for _, it := range m.items {
+        if it.Selected {
+            selected++
+        }
+    }
+
+    counter := fmt.Sprintf("%d/%d selected", selected, len(m.items))
+
+    if strings.TrimSpace(m.search.Value()) != "" {
+        counter += fmt.Sprintf(" · %d shown", len(m.visibleItems()))
+    }
+
+    return counter
+}
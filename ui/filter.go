@@ -0,0 +1,40 @@
+package ui
+
+import (
+    "strings"
+
+    "github.com/sahilm/fuzzy"
+)
+
+// filterFields returns the strings an item can be found by: its title, its
+// description (usually the address), the name of its group and its tags.
+func filterFields(it Item, groups map[string]Group) []string {
+    fields := []string{it.TitleText, it.DescriptionText}
+
+    if g, ok := groups[it.GroupID]; ok && g.Name != "" {
+        fields = append(fields, g.Name)
+    }
+
+    return append(fields, it.Tags...)
+}
+
+// matchesFilter reports whether the item matches the query. The query is
+// split on whitespace and every term has to fuzzy match at least one of the
+// item's fields, so "pay prod" finds "payments" in the "Production" vault.
+func matchesFilter(it Item, groups map[string]Group, query string) bool {
+    terms := strings.Fields(query)
+
+    if len(terms) == 0 {
+        return true
+    }
+
+    fields := filterFields(it, groups)
+
+    for _, term := range terms {
+        if len(fuzzy.FindNoSort(term, fields)) == 0 {
+            return false
+        }
+    }
+
+    return true
+}
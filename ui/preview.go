@@ -0,0 +1,117 @@
+package ui
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/charmbracelet/lipgloss"
+)
+
+// Detail is a labelled value shown in the preview pane for an item.
+type Detail struct {
+    Label string
+    Value string
+}
+
+// previewSideMinWidth is the terminal width from which the preview pane is
+// shown next to the list instead of below it.
+const previewSideMinWidth = 100
+
+var (
+    previewStyle = lipgloss.NewStyle().
+        Border(lipgloss.RoundedBorder()).
+        Padding(0, 1)
+    previewLabelStyle = lipgloss.NewStyle().Faint(true)
+    previewTitleStyle = lipgloss.NewStyle().Bold(true)
+)
+
+// previewSide reports whether the preview pane fits next to the list.
+func (m *model) previewSide() bool {
+    return m.width >= previewSideMinWidth
+}
+
+// previewHeight is the number of rows the preview pane takes when it is
+// shown below the list.
+func (m *model) previewHeight() int {
+    rows := 0
+    for _, it := range m.items {
+        rows = max(rows, len(it.Details))
+    }
+
+    // Title, group and borders
+    return rows + 4
+}
+
+// layout sizes the list and the preview pane for the current window.
+func (m *model) layout() {
+    height := m.height - 5
+
+    if m.previewSide() {
+        m.list.SetSize(m.width*3/5, height)
+        return
+    }
+
+    m.list.SetSize(m.width, max(height-m.previewHeight(), 3))
+}
+
+// previewView renders the details of the highlighted row.
+func (m model) previewView() string {
+    var b strings.Builder
+
+    switch v := m.list.SelectedItem().(type) {
+    case Item:
+        b.WriteString(previewTitleStyle.Render(v.TitleText))
+
+        rows := []Detail{}
+        if g, ok := m.groups[v.GroupID]; ok {
+            rows = append(rows, Detail{Label: "Group", Value: g.Name})
+        }
+        rows = append(rows, v.Details...)
+
+        width := 0
+        for _, d := range rows {
+            width = max(width, len(d.Label))
+        }
+
+        for _, d := range rows {
+            value := d.Value
+            if value == "" {
+                value = "-"
+            }
+
+            fmt.Fprintf(&b, "\n%s %s", previewLabelStyle.Render(fmt.Sprintf("%-*s", width, d.Label+":")), value)
+        }
+
+    case groupRow:
+        b.WriteString(previewTitleStyle.Render(v.Name))
+
+        if g, ok := m.groups[v.GroupID]; ok && g.Description != "" {
+            b.WriteString("\n" + g.Description)
+        }
+
+        total, selected := 0, 0
+        for _, it := range m.items {
+            if it.GroupID != v.GroupID {
+                continue
+            }
+            total++
+            if it.Selected {
+                selected++
+            }
+        }
+        fmt.Fprintf(&b, "\n%d of %d selected", selected, total)
+
+    default:
+        b.WriteString(previewLabelStyle.Render("Nothing highlighted"))
+    }
+
+    style := previewStyle
+    if m.previewSide() {
+        // Subtract the border, the list takes the rest
+        style = style.Width(m.width - m.width*3/5 - 2)
+    } else {
+        style = style.Width(m.width - 2)
+    }
+
+    return style.Render(b.String())
+}
@@ -5,27 +5,51 @@ import (
     "io"
     "os"
     "reflect"
+    "strings"
 
     tea "github.com/charmbracelet/bubbletea"
     "github.com/charmbracelet/bubbles/list"
+    "github.com/charmbracelet/bubbles/textinput"
+    "github.com/charmbracelet/lipgloss"
+    "github.com/charmbracelet/x/ansi"
 )
 
 var ErrAborted = fmt.Errorf("Selection aborted by user")
 
+var descriptionStyle = lipgloss.NewStyle().Faint(true)
+var newStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("2"))
+
 // Group represents metadata for a group of items.
 type Group struct {
     ID          string
     Name        string
     Description string
+    ParentID    string // enclosing group, for sources with nested groups, shown flat
 }
 
-// Public item type your Cobra command can use.
+// Item is a selectable row of the picker.
 type Item struct {
     ID              string
     TitleText       string
     DescriptionText string
     GroupID         string // empty => orphan (no group)
+    Environment     string // used by select-by-environment
+    Tags            []string
+    Details         []Detail // shown in the preview pane
     Selected        bool
+    New             bool // not offered in a previous run
+}
+
+// Options configure the initial state of the picker.
+type Options struct {
+    Grouped bool
+    Title   string // empty => ask which connections to export
+}
+
+// Result is the outcome of the picker.
+type Result struct {
+    Selected []Item
+    Grouped  bool // grouping state when the picker was closed
 }
 
 // Implement list.Item interface
@@ -74,7 +98,17 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
             indent = " |"
         }
 
-        fmt.Fprintf(w, "%s%s %s %s", cursor, indent, check, v.Title())
+        row := fmt.Sprintf("%s%s %s %s", cursor, indent, check, v.Title())
+
+        if v.New {
+            row += newStyle.Render(" new")
+        }
+
+        if v.Description() != "" {
+            row += descriptionStyle.Render("  " + v.Description())
+        }
+
+        fmt.Fprint(w, ansi.Truncate(row, m.Width(), "…"))
 
     case groupRow:
         // Group row: compute aggregate selection state
@@ -111,17 +145,22 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 // ---- Bubble Tea model ----
 
 type model struct {
-    list     list.Model
-    delegate itemDelegate
-    ready    bool
-    grouped  bool
-    groups   map[string]Group
-    items    []Item
-    done     bool
-    aborted  bool
+    list        list.Model
+    delegate    itemDelegate
+    search      textinput.Model
+    searching   bool // search input has focus
+    pickingEnv  bool // next digit selects an environment
+    ready       bool
+    width       int
+    height      int
+    grouped     bool
+    groups      map[string]Group
+    items       []Item
+    done        bool
+    aborted     bool
 }
 
-func newModel(items []Item, groups []*Group) model {
+func newModel(items []Item, groups []*Group, opts Options) model {
     groupMap := make(map[string]Group, len(groups))
     for _, g := range groups {
         if g == nil {
@@ -131,17 +170,26 @@ func newModel(items []Item, groups []*Group) model {
     }
 
     delegate := itemDelegate{
-        grouped: true,
+        grouped: opts.Grouped,
     }
     l := list.New(nil, delegate, 0, 0)
     l.Title = "Which connections would you like to export?"
+    if opts.Title != "" {
+        l.Title = opts.Title
+    }
     l.DisableQuitKeybindings() // we handle quitting ourselves
     l.SetShowStatusBar(false)
+    l.SetFilteringEnabled(false) // we filter ourselves, keeping group rows
+
+    search := textinput.New()
+    search.Prompt = "/"
+    search.Placeholder = "name, host, vault or tag"
 
     m := model{
         list:     l,
         delegate: delegate,
-        grouped:  true, // default: grouped view
+        search:   search,
+        grouped:  opts.Grouped,
         groups:   groupMap,
         items:    append([]Item(nil), items...), // copy
     }
@@ -152,7 +200,32 @@ func newModel(items []Item, groups []*Group) model {
 
 // rebuildListItems rebuilds the list.Model items from the canonical m.items.
 func (m *model) rebuildListItems() {
-    m.list.SetItems(buildListItems(m.items, m.groups, m.grouped))
+    m.list.SetItems(buildListItems(m.visibleItems(), m.groups, m.grouped))
+}
+
+// visibleItems returns the items matching the current search query.
+func (m *model) visibleItems() []Item {
+    query := m.search.Value()
+    if strings.TrimSpace(query) == "" {
+        return m.items
+    }
+
+    var out []Item
+    for _, it := range m.items {
+        if matchesFilter(it, m.groups, query) {
+            out = append(out, it)
+        }
+    }
+    return out
+}
+
+// visibleIDs returns the IDs of the items matching the current search query.
+func (m *model) visibleIDs() map[string]bool {
+    ids := make(map[string]bool, len(m.items))
+    for _, it := range m.visibleItems() {
+        ids[it.ID] = true
+    }
+    return ids
 }
 
 // buildListItems constructs list items, optionally inserting group rows.
@@ -193,14 +266,73 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
     switch msg := msg.(type) {
 
     case tea.WindowSizeMsg:
-        // Make the list fill (most of) the terminal.
+        // Make the list and preview fill (most of) the terminal.
         // Leave a couple of rows for the help text at the bottom.
         m.ready = true
-        m.list.SetSize(msg.Width, msg.Height-3)
+        m.width = msg.Width
+        m.height = msg.Height
+        m.layout()
         return m, nil
 
     case tea.KeyMsg:
+        if m.searching {
+            return m.updateSearch(msg)
+        }
+
+        if m.pickingEnv {
+            // Digits pick an environment, anything else cancels
+            m.pickingEnv = false
+            if k := msg.String(); len(k) == 1 && k[0] >= '1' && k[0] <= '9' {
+                m.selectEnvironment(int(k[0] - '1'))
+            }
+            return m, nil
+        }
+
         switch msg.String() {
+        case "/":
+            m.searching = true
+            return m, m.search.Focus()
+
+        case "esc":
+            // Clear an active search, otherwise let the list handle it
+            if m.search.Value() != "" {
+                m.search.Reset()
+                m.rebuildListItems()
+                return m, nil
+            }
+
+        case "a":
+            // Select every item in the current result set
+            m.updateSelection(func(it Item, visible bool) bool {
+                return it.Selected || visible
+            })
+            return m, nil
+
+        case "n":
+            // Deselect every item in the current result set
+            m.updateSelection(func(it Item, visible bool) bool {
+                return it.Selected && !visible
+            })
+            return m, nil
+
+        case "i":
+            // Invert the selection of the current result set
+            m.updateSelection(func(it Item, visible bool) bool {
+                return it.Selected != visible
+            })
+            return m, nil
+
+        case "f":
+            // Select exactly the items matching the current search
+            m.updateSelection(func(it Item, visible bool) bool {
+                return visible
+            })
+            return m, nil
+
+        case "e":
+            m.pickingEnv = true
+            return m, nil
+
         case "ctrl+c", "q":
             m.done = true
             m.aborted = true
@@ -241,17 +373,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                     return m, nil
                 }
 
-                // Decide whether to select-all or deselect-all
+                // Decide whether to select-all or deselect-all, only
+                // looking at the items matching the current search
                 anyUnselected := false
-                for _, it := range m.items {
+                for _, it := range m.visibleItems() {
                     if it.GroupID == groupID && !it.Selected {
                         anyUnselected = true
                         break
                     }
                 }
 
+                visible := m.visibleIDs()
                 for i := range m.items {
-                    if m.items[i].GroupID == groupID {
+                    if m.items[i].GroupID == groupID && visible[m.items[i].ID] {
                         m.items[i].Selected = anyUnselected
                     }
                 }
@@ -314,19 +448,79 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
     return m, cmd
 }
 
+// updateSearch handles key presses while the search input has focus.
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+    switch msg.String() {
+    case "ctrl+c":
+        m.done = true
+        m.aborted = true
+        return m, tea.Quit
+
+    case "esc":
+        // Leave search mode and drop the query
+        m.searching = false
+        m.search.Blur()
+        m.search.Reset()
+        m.rebuildListItems()
+        return m, nil
+
+    case "enter":
+        // Keep the query, and the keys go to the list again
+        m.searching = false
+        m.search.Blur()
+        return m, nil
+
+    case "down", "up":
+        // Keep the query, and move in the list right away
+        m.searching = false
+        m.search.Blur()
+        return m.Update(msg)
+    }
+
+    before := m.search.Value()
+
+    var cmd tea.Cmd
+    m.search, cmd = m.search.Update(msg)
+
+    if m.search.Value() != before {
+        m.rebuildListItems()
+        m.list.Select(0)
+    }
+
+    return m, cmd
+}
+
 func (m model) View() string {
     if m.done {
         return ""
     }
     view := m.list.View()
-    help := "\n[↑/↓] move  [space] select item/group  [g] toggle groups  [enter] confirm  [q] quit"
-    return view + help
+
+    if m.previewSide() {
+        view = lipgloss.JoinHorizontal(lipgloss.Top, view, m.previewView())
+    } else {
+        view = lipgloss.JoinVertical(lipgloss.Left, view, m.previewView())
+    }
+
+    search := ""
+    if m.searching || m.search.Value() != "" {
+        search = "\n" + m.search.View()
+    }
+
+    help := "\n" + m.counterView() + "  [↑/↓] move  [space] select item/group  [/] search  [esc] clear search  [g] toggle groups  [enter] confirm  [q] quit" +
+        "\n[a] select all  [n] select none  [i] invert  [f] select only matches  [e] select environment"
+    if m.searching {
+        help = "\n" + m.counterView() + "  [enter] done  [esc] clear search"
+    } else if m.pickingEnv {
+        help = "\n" + m.counterView() + "  " + m.environmentHelp()
+    }
+    return view + search + help
 }
 
 // Run starts the TUI and returns the selected items.
-func Run(items []Item, groups []*Group) ([]Item, error) {
+func Run(items []Item, groups []*Group, opts Options) (*Result, error) {
     p := tea.NewProgram(
-        newModel(items, groups),
+        newModel(items, groups, opts),
         tea.WithOutput(os.Stdout),
         tea.WithAltScreen(), // optional, but nicer full-screen UI
     )
@@ -342,12 +536,12 @@ func Run(items []Item, groups []*Group) ([]Item, error) {
         return nil, ErrAborted
     }
 
-    var selected []Item
+    result := &Result{Grouped: finalModel.grouped}
     for _, it := range finalModel.items {
         if it.Selected {
-            selected = append(selected, it)
+            result.Selected = append(result.Selected, it)
         }
     }
 
-    return selected, nil
+    return result, nil
 }
@@ -0,0 +1,322 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "maps"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "slices"
+    "strings"
+    "time"
+
+    "tableplus-connections/ui"
+)
+
+const (
+    vaultAddrEnv      = "VAULT_ADDR"
+    vaultTokenEnv     = "VAULT_TOKEN"
+    vaultNamespaceEnv = "VAULT_NAMESPACE"
+    defaultVaultAddr  = "https://127.0.0.1:8200"
+)
+
+// vaultClient talks to the Vault HTTP API, configured like the vault CLI.
+type vaultClient struct {
+    addr      string
+    token     string
+    namespace string
+    http      *http.Client
+}
+
+// vaultErrorResponse is the body of a failed Vault request.
+type vaultErrorResponse struct {
+    Errors []string `json:"errors"`
+}
+
+// errVaultNotFound is returned for paths without secrets, which Vault
+// answers with a 404.
+var errVaultNotFound = errors.New("not found")
+
+func newVaultClient() (*vaultClient, error) {
+    client := &vaultClient{
+        addr:      strings.TrimSuffix(os.Getenv(vaultAddrEnv), "/"),
+        token:     os.Getenv(vaultTokenEnv),
+        namespace: os.Getenv(vaultNamespaceEnv),
+        http:      &http.Client{Timeout: 30 * time.Second},
+    }
+
+    if client.addr == "" {
+        client.addr = defaultVaultAddr
+    }
+
+    if client.token == "" {
+        home, err := os.UserHomeDir()
+
+        if err == nil {
+            token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+
+            if err == nil {
+                client.token = strings.TrimSpace(string(token))
+            }
+        }
+    }
+
+    if client.token == "" {
+        return nil, fmt.Errorf("The Vault source needs a token, set %s or log in with vault login", vaultTokenEnv)
+    }
+
+    return client, nil
+}
+
+// request sends a request to the API path (without /v1/) and decodes the
+// response into out.
+func (v *vaultClient) request(method, apiPath string, out any) error {
+    req, err := http.NewRequest(method, v.addr+"/v1/"+apiPath, nil)
+
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("X-Vault-Token", v.token)
+
+    if v.namespace != "" {
+        req.Header.Set("X-Vault-Namespace", v.namespace)
+    }
+
+    resp, err := v.http.Do(req)
+
+    if err != nil {
+        return err
+    }
+
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return errVaultNotFound
+    }
+
+    if resp.StatusCode >= 300 {
+        body := &vaultErrorResponse{}
+        json.NewDecoder(resp.Body).Decode(body)
+
+        if len(body.Errors) == 0 {
+            return fmt.Errorf("Vault %s: %s", apiPath, resp.Status)
+        }
+
+        return fmt.Errorf("Vault %s: %s", apiPath, strings.Join(body.Errors, ", "))
+    }
+
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// list returns the keys below a KV v2 path; those of directories end in a
+// slash.
+func (v *vaultClient) list(mount, dir string) ([]string, error) {
+    var resp struct {
+        Data struct {
+            Keys []string `json:"keys"`
+        } `json:"data"`
+    }
+
+    err := v.request("LIST", path.Join(mount, "metadata", escapeVaultPath(dir)), &resp)
+
+    if errors.Is(err, errVaultNotFound) {
+        return nil, nil
+    }
+
+    return resp.Data.Keys, err
+}
+
+// read returns the latest version of a KV v2 secret.
+func (v *vaultClient) read(mount, secret string) (map[string]any, time.Time, error) {
+    var resp struct {
+        Data struct {
+            Data     map[string]any `json:"data"`
+            Metadata struct {
+                CreatedTime time.Time `json:"created_time"`
+            } `json:"metadata"`
+        } `json:"data"`
+    }
+
+    err := v.request("GET", path.Join(mount, "data", escapeVaultPath(secret)), &resp)
+
+    return resp.Data.Data, resp.Data.Metadata.CreatedTime, err
+}
+
+// credentials requests dynamic credentials from a database secrets engine
+// path like database/creds/readonly.
+func (v *vaultClient) credentials(credsPath string) (string, string, time.Duration, error) {
+    var resp struct {
+        LeaseDuration int `json:"lease_duration"`
+        Data          struct {
+            Username string `json:"username"`
+            Password string `json:"password"`
+        } `json:"data"`
+    }
+
+    if err := v.request("GET", escapeVaultPath(credsPath), &resp); err != nil {
+        return "", "", 0, err
+    }
+
+    return resp.Data.Username, resp.Data.Password, time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+func escapeVaultPath(p string) string {
+    segments := strings.Split(strings.Trim(p, "/"), "/")
+
+    for i, segment := range segments {
+        segments[i] = url.PathEscape(segment)
+    }
+
+    return strings.Join(segments, "/")
+}
+
+// vaultCredsPath returns the path dynamic credentials are requested from
+// for the role field of a secret: a role of the engine mounted at
+// "database", or a full path like db-prod/creds/readonly.
+func vaultCredsPath(role string) string {
+    role = strings.Trim(strings.TrimSpace(role), "/")
+
+    if strings.Contains(role, "/") {
+        return role
+    }
+
+    return "database/creds/" + role
+}
+
+// loadVault reads the connections defined below a Vault KV v2 path, given
+// as --source-path like secret/databases. Every secret is a connection,
+// with fields like host, port, username and password; a secret with a role
+// field gets dynamic credentials from the database secrets engine once
+// picked, which expire with their lease. Every directory is a group, named
+// by its path below the source path.
+func loadVault(opts ExportOptions) (*SourceResult, error) {
+    mount, root, _ := strings.Cut(strings.Trim(opts.SourcePath, "/"), "/")
+
+    if mount == "" {
+        return nil, errors.New("The Vault source needs the KV path as --source-path, like secret/databases")
+    }
+
+    client, err := newVaultClient()
+
+    if err != nil {
+        return nil, err
+    }
+
+    result := &SourceResult{}
+    groups := make(map[string]*ui.Group)
+    roles := make(map[string]string)
+
+    var walk func(dir string) error
+    walk = func(dir string) error {
+        keys, err := client.list(mount, path.Join(root, dir))
+
+        if err != nil {
+            return err
+        }
+
+        for _, key := range keys {
+            if strings.HasSuffix(key, "/") {
+                if err := walk(path.Join(dir, key)); err != nil {
+                    return err
+                }
+
+                continue
+            }
+
+            name := path.Join(dir, key)
+            connection := &AvailableConnection{
+                ID:   "vault:" + path.Join(mount, root, name),
+                Name: key,
+            }
+
+            if dir != "" {
+                connection.GroupID = pathGroup("vault:"+path.Join(mount, root)+"/", dir, groups).ID
+            }
+
+            secret, updatedAt, err := client.read(mount, path.Join(root, name))
+
+            // Listed by its metadata, but its latest version is deleted or
+            // destroyed
+            if errors.Is(err, errVaultNotFound) {
+                result.Skipped = append(result.Skipped, SkippedItem{
+                    ID:      connection.ID,
+                    GroupID: connection.GroupID,
+                    Name:    connection.Name,
+                    Reason:  "latest version deleted or destroyed",
+                })
+                continue
+            }
+
+            if err != nil {
+                return err
+            }
+
+            connection.UpdatedAt = updatedAt
+
+            for _, field := range slices.Sorted(maps.Keys(secret)) {
+                value := fmt.Sprint(secret[field])
+
+                switch strings.ToLower(field) {
+                case "role", "dynamic_role", "creds_path":
+                    roles[connection.ID] = vaultCredsPath(value)
+                default:
+                    setConnectionField(connection, field, value)
+                }
+            }
+
+            if missing := completeConnection(connection); len(missing) > 0 {
+                result.Skipped = append(result.Skipped, SkippedItem{
+                    ID:      connection.ID,
+                    GroupID: connection.GroupID,
+                    Name:    connection.Name,
+                    Reason:  "missing or invalid " + strings.Join(missing, ", "),
+                })
+                continue
+            }
+
+            result.Connections = append(result.Connections, connection)
+        }
+
+        return nil
+    }
+
+    if err := walk(""); err != nil {
+        return nil, err
+    }
+
+    for _, dir := range slices.Sorted(maps.Keys(groups)) {
+        result.Groups = append(result.Groups, groups[dir])
+    }
+
+    result.Resolve = func(selected []*AvailableConnection) ([]*AvailableConnection, error) {
+        for _, connection := range selected {
+            credsPath, ok := roles[connection.ID]
+
+            if !ok {
+                continue
+            }
+
+            username, password, ttl, err := client.credentials(credsPath)
+
+            if err != nil {
+                return nil, fmt.Errorf("%s: %w", connection.Name, err)
+            }
+
+            connection.Username = username
+            connection.Password = password
+
+            if ttl > 0 {
+                connection.ExpiresAt = time.Now().Add(ttl)
+            }
+        }
+
+        return selected, nil
+    }
+
+    return result, nil
+}